@@ -1,58 +1,134 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+	_ "time/tzdata"
 
 	"github.com/MichaelWittgreffe/jobengine/pkg/api"
 	"github.com/MichaelWittgreffe/jobengine/pkg/crypto"
 	"github.com/MichaelWittgreffe/jobengine/pkg/database"
 	"github.com/MichaelWittgreffe/jobengine/pkg/filesystem"
 	"github.com/MichaelWittgreffe/jobengine/pkg/logger"
+	"github.com/MichaelWittgreffe/jobengine/pkg/tracing"
 )
 
 func main() {
-	logger := logger.NewLogger("std")
 	fileHandler := filesystem.NewFileSystem("os")
+	log := getLogger(fileHandler)
 	dbFile := database.NewDBFile()
-	dbPath, apiPort, secretKey := getEnvVars(logger, fileHandler)
+	dbPath, apiPort, secretKey, dbHandlerType := getEnvVars(log, fileHandler)
+	tracer := getTracer(log, fileHandler)
+	shutdownTimeout := getShutdownTimeout(log, fileHandler)
 
-	dbFileHandler := database.NewDBFileHandler(
-		"fs",
+	dbFileHandler := database.NewTracedDBFileHandler(database.NewDBFileHandler(
+		dbHandlerType,
 		crypto.NewEncryptionHandler(secretKey, "AES", crypto.NewHashHandler("md5")),
 		database.NewDBDataHandler("json"),
 		fileHandler,
-	)
+	), tracer)
 	if dbFileHandler == nil {
-		logger.Fatal("Unable To Create File Handler")
+		log.Fatal("Unable To Create File Handler", logger.F("handler", dbHandlerType))
 	}
 
 	if exists, err := fileHandler.FileExists(dbPath); err == nil {
 		if exists {
 			if err = dbFileHandler.LoadFromFile(dbFile, dbPath); err == nil {
-				logger.Info("Database Loaded")
+				log.Info("Database Loaded", logger.F("path", dbPath))
+			} else {
+				log.Fatal("Error Loading Database", logger.F("path", dbPath), logger.F("error", err))
 			}
 		} else {
 			if err = dbFileHandler.SaveToFile(dbFile, dbPath); err == nil {
-				logger.Info("Database Created")
+				log.Info("Database Created", logger.F("path", dbPath))
+			} else {
+				log.Fatal("Error Creating Database", logger.F("path", dbPath), logger.F("error", err))
 			}
 		}
 	} else {
-		logger.Fatal(fmt.Sprintf("Error Locating DB File: %s", err.Error()))
+		log.Fatal("Error Locating DB File", logger.F("path", dbPath), logger.F("error", err))
 	}
 
-	dbFileMonitor := database.NewDBFileMonitor(dbFile, dbPath, dbFileHandler, logger)
+	writeInterval, maxStaleness := getWriteIntervals(log, fileHandler)
+	dbFileMonitor := database.NewDBFileMonitor(dbFile, dbPath, dbFileHandler, log, writeInterval, maxStaleness)
 	if dbFileMonitor == nil {
-		logger.Fatal("Failed Creating Monitor")
+		log.Fatal("Failed Creating Monitor", logger.F("write_interval", writeInterval.String()), logger.F("max_staleness", maxStaleness.String()))
 	}
 	go dbFileMonitor.Start()
 
-	httpAPI := api.NewHTTPAPI(logger, dbFileMonitor, database.NewQueryController(dbFile, crypto.NewHashHandler("sha512")))
-	logger.Info(fmt.Sprintf("Started Listening On Port %s", apiPort))
-	logger.Fatal(httpAPI.ListenAndServe(apiPort).Error())
+	queryController := database.NewTracedQueryController(database.NewQueryController(dbFile, crypto.NewHashHandler("sha512"), log))
+	scheduler := database.NewDBScheduler(queryController, dbFileMonitor, log)
+	if scheduler == nil {
+		log.Fatal("Failed Creating Scheduler")
+	}
+	go scheduler.Start()
+
+	httpAPI := api.NewHTTPAPI(log, dbFileMonitor, queryController, tracer)
+	if httpAPI == nil {
+		log.Fatal("Failed Creating API")
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	listenErr := make(chan error, 1)
+	go func() {
+		listenErr <- httpAPI.ListenAndServe(apiPort)
+	}()
+	log.Info("Started Listening", logger.F("port", apiPort))
+
+	exitCode := 0
+	select {
+	case sig := <-signals:
+		log.Info("Shutting Down", logger.F("signal", sig.String()))
+	case err := <-listenErr:
+		log.Error("Stopped Listening", logger.F("error", err))
+		exitCode = 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := httpAPI.Shutdown(ctx); err != nil && err != http.ErrServerClosed {
+		log.Error("Error Draining Requests", logger.F("error", err))
+		exitCode = 1
+	}
+	scheduler.Stop()
+	if err := dbFileMonitor.Stop(ctx); err != nil {
+		log.Error("Error Flushing Database", logger.F("path", dbPath), logger.F("error", err))
+		exitCode = 1
+	} else {
+		log.Info("Database Flushed", logger.F("path", dbPath))
+	}
+	if err := tracer.Shutdown(); err != nil {
+		log.Error("Error Exporting Traces", logger.F("error", err))
+	}
+
+	log.Info("Stopped", logger.F("exit_code", exitCode))
+	os.Exit(exitCode)
+}
+
+// getLogger returns the logger for the format and level set by env vars, text at 'info' by default - exits app if
+// either is not valid
+func getLogger(fh filesystem.FileSystem) logger.Logger {
+	logFormat := fh.GetEnv("LOG_FORMAT")
+	if len(logFormat) <= 0 {
+		logFormat = "text"
+	}
+
+	log := logger.NewLogger(logFormat, fh.GetEnv("LOG_LEVEL"))
+	if log == nil {
+		logger.NewLogger("text", "").Fatal("Invalid LOG_FORMAT Or LOG_LEVEL", logger.F("format", logFormat), logger.F("level", fh.GetEnv("LOG_LEVEL")))
+	}
+	return log
 }
 
 // getEnvVars returns the required env var values/default values - exits app if mandatory values are not populated
-func getEnvVars(l logger.Logger, fh filesystem.FileSystem) (string, string, string) {
+func getEnvVars(l logger.Logger, fh filesystem.FileSystem) (string, string, string, string) {
 	dbPath := fh.GetEnv("DB_PATH")
 	if len(dbPath) <= 0 {
 		l.Info("DB_PATH Not Defined, Using Default")
@@ -70,5 +146,70 @@ func getEnvVars(l logger.Logger, fh filesystem.FileSystem) (string, string, stri
 		l.Fatal("SECRET Not Defined")
 	}
 
-	return dbPath, apiPort, secretKey
+	dbHandlerType := fh.GetEnv("DB_HANDLER")
+	if len(dbHandlerType) <= 0 {
+		l.Info("DB_HANDLER Not Defined, Using Default")
+		dbHandlerType = "fs"
+	}
+
+	return dbPath, apiPort, secretKey, dbHandlerType
+}
+
+// getWriteIntervals returns how long to wait for further changes before writing the database, and the longest a change
+// can wait to be written, set by env vars as durations such as '250ms' - 100ms and 1s by default, exits app if either is
+// not valid
+func getWriteIntervals(l logger.Logger, fh filesystem.FileSystem) (time.Duration, time.Duration) {
+	writeInterval, maxStaleness := 100*time.Millisecond, time.Second
+
+	if value := fh.GetEnv("DB_WRITE_INTERVAL"); len(value) > 0 {
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval < 0 {
+			l.Fatal("Invalid DB_WRITE_INTERVAL", logger.F("interval", value))
+		}
+		writeInterval = interval
+	}
+
+	if value := fh.GetEnv("DB_MAX_STALENESS"); len(value) > 0 {
+		staleness, err := time.ParseDuration(value)
+		if err != nil || staleness < writeInterval {
+			l.Fatal("Invalid DB_MAX_STALENESS, Must Be At Least DB_WRITE_INTERVAL", logger.F("staleness", value))
+		}
+		maxStaleness = staleness
+	} else if maxStaleness < writeInterval {
+		maxStaleness = writeInterval
+	}
+
+	return writeInterval, maxStaleness
+}
+
+// getShutdownTimeout returns how long to wait for requests to finish and the database to be flushed when stopping, 20
+// seconds by default - exits app if the value is not a positive number of seconds
+func getShutdownTimeout(l logger.Logger, fh filesystem.FileSystem) time.Duration {
+	timeout := fh.GetEnv("SHUTDOWN_TIMEOUT")
+	if len(timeout) <= 0 {
+		return 20 * time.Second
+	}
+
+	seconds, err := strconv.Atoi(timeout)
+	if err != nil || seconds <= 0 {
+		l.Fatal("Invalid SHUTDOWN_TIMEOUT", logger.F("timeout", timeout))
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// getTracer returns the tracer for the exporter set by env vars, spans are not exported if no exporter is set - exits app
+// if the exporter cannot be created
+func getTracer(l logger.Logger, fh filesystem.FileSystem) *tracing.Tracer {
+	exporterType := fh.GetEnv("TRACE_EXPORTER")
+	if len(exporterType) <= 0 || exporterType == "none" {
+		return tracing.NewTracer("jobengine", nil)
+	}
+
+	exporter := tracing.NewExporter(exporterType, fh.GetEnv("TRACE_TARGET"))
+	if exporter == nil {
+		l.Fatal("Unable To Create Trace Exporter", logger.F("exporter", exporterType))
+	}
+
+	l.Info("Exporting Traces", logger.F("exporter", exporterType))
+	return tracing.NewTracer("jobengine", exporter)
 }
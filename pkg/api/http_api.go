@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"strings"
@@ -8,11 +9,36 @@ import (
 
 	"github.com/MichaelWittgreffe/jobengine/pkg/database"
 	"github.com/MichaelWittgreffe/jobengine/pkg/logger"
+	"github.com/MichaelWittgreffe/jobengine/pkg/metrics"
+	"github.com/MichaelWittgreffe/jobengine/pkg/tracing"
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 	"github.com/google/uuid"
 )
 
+// maxWaitSeconds is the longest a request for the next job can wait for one to become avalible
+const maxWaitSeconds int64 = 30
+
+// requestTimeout is the longest a request is handled for before it is cancelled
+const requestTimeout = 10 * time.Second
+
+// waitTimeout is the longest a request for the next job is handled for, so it can wait the longest it can for a job and
+// still have as long as any other request to claim it
+const waitTimeout = time.Duration(maxWaitSeconds)*time.Second + requestTimeout
+
+// maxClaimCount is the most jobs that can be claimed by a single request for the next jobs
+const maxClaimCount int64 = 100
+
+// maxBulkJobs is the most jobs that can be added by a single bulk request
+const maxBulkJobs = 10000
+
+// waitRecheck is how often a waiting request checks the queue again without being woken, delayed jobs and expired leases
+// become avalible without a notification
+const waitRecheck = time.Second
+
+// waitMargin is left before the request deadline when waiting, so there is time to respond before it times out
+const waitMargin = 500 * time.Millisecond
+
 // HTTPAPI is an object for an HTTP/1.1 API for controlling the application
 type HTTPAPI struct {
 	router  *chi.Mux
@@ -20,11 +46,16 @@ type HTTPAPI struct {
 	monitor database.DBMonitor
 	control database.QueryController
 	json    *database.JSONDataHandler
+	metrics *metrics.Registry
+	latency *metrics.HistogramVec
+	tracer  *tracing.Tracer
+	server  *http.Server
+	closing chan struct{}
 }
 
 // NewHTTPAPI is a constructor for an HttpAPI object
-func NewHTTPAPI(logger logger.Logger, monitor database.DBMonitor, controller database.QueryController) *HTTPAPI {
-	if logger == nil || monitor == nil || controller == nil {
+func NewHTTPAPI(logger logger.Logger, monitor database.DBMonitor, controller database.QueryController, tracer *tracing.Tracer) *HTTPAPI {
+	if logger == nil || monitor == nil || controller == nil || tracer == nil {
 		return nil
 	}
 
@@ -33,33 +64,153 @@ func NewHTTPAPI(logger logger.Logger, monitor database.DBMonitor, controller dat
 		monitor: monitor,
 		control: controller,
 		json:    new(database.JSONDataHandler),
+		tracer:  tracer,
+		closing: make(chan struct{}),
+		latency: metrics.NewHistogramVec(
+			"jobengine_http_request_seconds",
+			"Seconds taken to handle HTTP requests",
+			metrics.DefaultBuckets,
+			"route", "method", "status",
+		),
 	}
+	api.metrics = metrics.NewRegistry(api.latency, controller, monitor)
 
 	api.router = chi.NewRouter()
+	api.server = &http.Server{Handler: api.router}
 	api.router.Use(middleware.RequestID)
 	api.router.Use(middleware.RealIP)
-	api.router.Use(middleware.Logger)
+	api.router.Use(api.recordLatency)
+	api.router.Use(api.traceRequest)
+	api.router.Use(api.logRequest)
 	api.router.Use(middleware.Recoverer)
-	api.router.Use(middleware.Timeout(10 * time.Second))
 
-	api.router.Get("/test", api.Test)
+	// requests for the next job can wait for one, so they are given longer before timing out than any other
+	api.router.With(middleware.Timeout(waitTimeout)).Get("/api/v1/job/next", api.GetNextJob)
+	api.router.Group(func(r chi.Router) {
+		r.Use(middleware.Timeout(requestTimeout))
+
+		r.Get("/test", api.Test)
+		r.Method(http.MethodGet, "/metrics", api.metrics)
 
-	api.router.Put("/api/v1/queue", api.CreateQueue)
-	api.router.Get("/api/v1/queue", api.GetQueue)
-	api.router.Delete("/api/v1/queue", api.DeleteQueue)
+		r.Put("/api/v1/queue", api.CreateQueue)
+		r.Get("/api/v1/queue", api.GetQueue)
+		r.Delete("/api/v1/queue", api.DeleteQueue)
 
-	api.router.Put("/api/v1/job", api.AddJob)
-	api.router.Get("/api/v1/job", api.GetJob)
-	api.router.Get("/api/v1/job/next", api.GetNextJob)
-	api.router.Post("/api/v1/job", api.UpdateJobStatus)
-	api.router.Delete("/api/v1/job", api.DeleteJob)
+		r.Put("/api/v1/job", api.AddJob)
+		r.Put("/api/v1/job/bulk", api.AddJobs)
+		r.Post("/api/v1/job/bulk", api.ApplyJobOperation)
+		r.Get("/api/v1/job", api.GetJob)
+		r.Get("/api/v1/job/list", api.ListJobs)
+		r.Post("/api/v1/job", api.UpdateJobStatus)
+		r.Post("/api/v1/job/heartbeat", api.Heartbeat)
+		r.Post("/api/v1/job/reject", api.RejectJob)
+
+		r.Get("/api/v1/deadletter", api.GetDeadLetterJobs)
+		r.Post("/api/v1/deadletter/redrive", api.RedriveJobs)
+
+		r.Put("/api/v1/schedule", api.CreateSchedule)
+		r.Get("/api/v1/schedule", api.GetSchedules)
+		r.Delete("/api/v1/schedule", api.DeleteSchedule)
+
+		r.Put("/api/v1/workflow", api.AddWorkflow)
+		r.Get("/api/v1/workflow", api.GetWorkflow)
+
+		r.Get("/api/v1/stats", api.GetStats)
+		r.Delete("/api/v1/job", api.DeleteJob)
+	})
 
 	return api
 }
 
-// ListenAndServe starts the API listening for requets, blocks current goroutine
+// ListenAndServe starts the API listening for requets, blocks current goroutine until the API is shutdown. Returns
+// http.ErrServerClosed once Shutdown is called
 func (a *HTTPAPI) ListenAndServe(port string) error {
-	return http.ListenAndServe(fmt.Sprintf("0.0.0.0:%s", port), a.router)
+	a.server.Addr = fmt.Sprintf("0.0.0.0:%s", port)
+	return a.server.ListenAndServe()
+}
+
+// Shutdown stops the API accepting connections and waits for the requests in progress to finish, requests waiting for
+// a job return straight away. Returns the error of ctx if it ends before they finish
+func (a *HTTPAPI) Shutdown(ctx context.Context) error {
+	close(a.closing)
+	return a.server.Shutdown(ctx)
+}
+
+// recordLatency is middleware recording how long each request took by the route it matched and the status returned
+func (a *HTTPAPI) recordLatency(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		writer := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(writer, r)
+
+		a.latency.Observe(time.Since(started).Seconds(), routePattern(r), r.Method, fmt.Sprintf("%d", responseStatus(writer)))
+	})
+}
+
+// traceRequest is middleware recording a span for each request, continuing the trace of the client if the request has
+// a W3C traceparent header
+func (a *HTTPAPI) traceRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if remote, ok := tracing.ParseTraceParent(r.Header.Get(tracing.TraceParentHeader), r.Header.Get(tracing.TraceStateHeader)); ok {
+			ctx = tracing.WithRemote(ctx, remote)
+		}
+
+		ctx, span := a.tracer.Start(ctx, r.Method, tracing.KindServer)
+		defer span.End()
+
+		writer := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(writer, r.WithContext(ctx))
+
+		route, status := routePattern(r), responseStatus(writer)
+		span.Name = r.Method + " " + route
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("http.route", route)
+		span.SetAttribute("http.status_code", status)
+		if status >= http.StatusInternalServerError {
+			span.SetError(fmt.Errorf("%s", http.StatusText(status)))
+		}
+	})
+}
+
+// logRequest is middleware logging each request once handled, every message logged for the request carries its id,
+// trace and the queue and job it is for once known
+func (a *HTTPAPI) logRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		fields := []logger.Field{logger.F("request_id", middleware.GetReqID(r.Context()))}
+		if span := tracing.FromContext(r.Context()); span != nil {
+			fields = append(fields, logger.F("trace_id", span.Context.TraceID.String()))
+		}
+
+		// the queue and job are taken from the query where given, handlers add them from the body
+		requestLog := newRequestLog(a.logger.With(fields...))
+		requestLog.setJob(r.URL.Query().Get("queueName"), r.URL.Query().Get("jobUID"))
+
+		writer := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(writer, r.WithContext(logger.NewContext(r.Context(), requestLog)))
+
+		status := responseStatus(writer)
+		fields = []logger.Field{
+			logger.F("method", r.Method),
+			logger.F("path", r.URL.Path),
+			logger.F("route", routePattern(r)),
+			logger.F("status", status),
+			logger.F("bytes", writer.BytesWritten()),
+			logger.F("duration_ms", float64(time.Since(started))/float64(time.Millisecond)),
+			logger.F("remote_addr", r.RemoteAddr),
+		}
+		if status >= http.StatusInternalServerError {
+			requestLog.Error("Request Handled", fields...)
+		} else {
+			requestLog.Info("Request Handled", fields...)
+		}
+	})
+}
+
+// controller returns the query controller making queries as part of the given request
+func (a *HTTPAPI) controller(r *http.Request) database.QueryController {
+	return a.control.WithContext(r.Context())
 }
 
 // Test is a simple 'is-alive' endpoint handler, returning a 200 status code
@@ -74,8 +225,9 @@ func (a *HTTPAPI) CreateQueue(w http.ResponseWriter, r *http.Request) {
 		returnStatusCode(http.StatusBadRequest, w)
 		return
 	}
+	logJob(r, body.Name, "")
 
-	if err := a.control.CreateQueue(body.Name, body.AccessKey); err != nil {
+	if err := a.controller(r).CreateQueue(body.Name, body.AccessKey, &body.QueueOptions); err != nil {
 		errStr := err.Error()
 		switch {
 		case errStr == "Invalid Arg":
@@ -83,12 +235,14 @@ func (a *HTTPAPI) CreateQueue(w http.ResponseWriter, r *http.Request) {
 		case errStr == "Queue Exists":
 			returnStatusCode(http.StatusConflict, w)
 		default:
-			returnInternalServerError(err, w, a.json)
+			returnInternalServerError(err, w, r, a.json)
 		}
 		return
 	}
 
-	a.monitor.Write()
+	if !commitChanges(a.monitor, w, r, a.json, syncDurability(a.controller(r), body.Name)) {
+		return
+	}
 	returnStatusCode(http.StatusCreated, w)
 }
 
@@ -96,17 +250,18 @@ func (a *HTTPAPI) CreateQueue(w http.ResponseWriter, r *http.Request) {
 func (a *HTTPAPI) GetQueue(w http.ResponseWriter, r *http.Request) {
 	queueName := r.URL.Query().Get("name")
 	accessKey := r.Header.Get("X-Access-Key")
+	logJob(r, queueName, "")
 	if len(queueName) == 0 || len(accessKey) == 0 {
 		returnStatusCode(http.StatusBadRequest, w)
 		return
 	}
 
 	// regardless whether the user has access, we should use this time to update the queue
-	if !updateQueue(queueName, a.control, w, a.json, a.monitor) {
+	if !updateQueue(queueName, a.controller(r), w, r, a.json, a.monitor) {
 		return
 	}
 
-	queue, err := a.control.GetQueue(queueName, accessKey)
+	queue, err := a.controller(r).GetQueue(queueName, accessKey)
 	if err != nil {
 		errStr := err.Error()
 		switch {
@@ -115,7 +270,7 @@ func (a *HTTPAPI) GetQueue(w http.ResponseWriter, r *http.Request) {
 		case errStr == "Unauthorized":
 			returnStatusCode(http.StatusUnauthorized, w)
 		default:
-			returnInternalServerError(err, w, a.json)
+			returnInternalServerError(err, w, r, a.json)
 		}
 		return
 	} else if queue == nil && err == nil {
@@ -127,9 +282,10 @@ func (a *HTTPAPI) GetQueue(w http.ResponseWriter, r *http.Request) {
 	response.Jobs = queue.Jobs
 	response.Name = queue.Name
 	response.Size = queue.Size
+	response.QueueOptions = queue.QueueOptions
 
 	if err = returnResponseBody(http.StatusOK, response, w, a.json); err != nil {
-		returnInternalServerError(err, w, a.json)
+		returnInternalServerError(err, w, r, a.json)
 	}
 }
 
@@ -137,12 +293,15 @@ func (a *HTTPAPI) GetQueue(w http.ResponseWriter, r *http.Request) {
 func (a *HTTPAPI) DeleteQueue(w http.ResponseWriter, r *http.Request) {
 	queueName := r.URL.Query().Get("name")
 	accessKey := r.Header.Get("X-Access-Key")
+	logJob(r, queueName, "")
 	if len(queueName) == 0 || len(accessKey) == 0 {
 		returnStatusCode(http.StatusBadRequest, w)
 		return
 	}
 
-	if err := a.control.DeleteQueue(queueName, accessKey); err != nil {
+	// taken before the queue is deleted, as the deletion is saved as the queue was
+	sync := syncDurability(a.controller(r), queueName)
+	if err := a.controller(r).DeleteQueue(queueName, accessKey); err != nil {
 		errStr := err.Error()
 		switch {
 		case errStr == "Invalid Args":
@@ -152,12 +311,14 @@ func (a *HTTPAPI) DeleteQueue(w http.ResponseWriter, r *http.Request) {
 		case errStr == "Not Found":
 			returnStatusCode(http.StatusNotFound, w)
 		default:
-			returnInternalServerError(err, w, a.json)
+			returnInternalServerError(err, w, r, a.json)
 		}
 		return
 	}
 
-	a.monitor.Write()
+	if !commitChanges(a.monitor, w, r, a.json, sync) {
+		return
+	}
 	returnStatusCode(http.StatusNoContent, w)
 }
 
@@ -166,18 +327,136 @@ func (a *HTTPAPI) AddJob(w http.ResponseWriter, r *http.Request) {
 	accessKey := r.Header.Get("X-Access-Key")
 	body := new(AddJobRequest)
 	err := getRequestBody(body, r, a.json)
-	if len(accessKey) == 0 || err != nil {
+	if len(accessKey) == 0 || err != nil || body.Job == nil || body.DelaySeconds < 0 || (body.DelaySeconds > 0 && body.Job.RunAt > 0) {
+		returnStatusCode(http.StatusBadRequest, w)
+		return
+	}
+
+	job := newJob(r.Context(), body.Job, time.Now().Unix())
+	logJob(r, body.QueueName, job.UID)
+	if body.DelaySeconds > 0 {
+		job.RunAt = job.Created + body.DelaySeconds
+	}
+
+	job.IdempotencyKey = body.IdempotencyKey
+
+	stored, created, err := a.controller(r).AddJob(job, body.QueueName, accessKey)
+	if err != nil {
+		errStr := err.Error()
+		switch {
+		case errStr == "Invalid Args":
+			returnStatusCode(http.StatusBadRequest, w)
+		case errStr == "Unauthorized":
+			returnStatusCode(http.StatusUnauthorized, w)
+		case errStr == "Not Found":
+			returnStatusCode(http.StatusNotFound, w)
+		case errStr == "Job Exists":
+			returnStatusCode(http.StatusConflict, w)
+		default:
+			returnInternalServerError(err, w, r, a.json)
+		}
+		return
+	} else if !created {
+		// the job was already added with this idempotency key, or merged into an active job with the same unique fields
+		if !commitChanges(a.monitor, w, r, a.json, syncDurability(a.controller(r), body.QueueName)) {
+			return
+		}
+		if err = returnResponseBody(http.StatusOK, stored, w, a.json); err != nil {
+			returnInternalServerError(err, w, r, a.json)
+		}
+		return
+	}
+
+	a.controller(r).UpdateQueue(body.QueueName)
+	if !commitChanges(a.monitor, w, r, a.json, syncDurability(a.controller(r), body.QueueName)) {
+		return
+	}
+	if err = returnResponseBody(http.StatusCreated, stored, w, a.json); err != nil {
+		returnInternalServerError(err, w, r, a.json)
+	}
+}
+
+// AddJobs is an endpoint handler for adding many jobs across one or more queues in a single request, each job is reported
+// in the response in the order given
+func (a *HTTPAPI) AddJobs(w http.ResponseWriter, r *http.Request) {
+	accessKey := r.Header.Get("X-Access-Key")
+	body := new(AddJobsRequest)
+	err := getRequestBody(body, r, a.json)
+	if len(accessKey) == 0 || err != nil || len(body.Jobs) == 0 || len(body.Jobs) > maxBulkJobs {
 		returnStatusCode(http.StatusBadRequest, w)
 		return
 	}
 
-	job := body.Job
-	job.Created = time.Now().Unix()
-	job.LastUpdated = job.Created
-	job.State = database.Queued
-	job.UID = uuid.New().String()
+	currentTime := time.Now().Unix()
+	jobs := make([]*database.BulkJob, len(body.Jobs))
+	for i, item := range body.Jobs {
+		jobs[i] = new(database.BulkJob)
+		if item == nil || item.Job == nil || item.DelaySeconds < 0 || (item.DelaySeconds > 0 && item.Job.RunAt > 0) {
+			// left without a job to be reported as invalid
+			continue
+		}
+
+		job := newJob(r.Context(), item.Job, currentTime)
+		if item.DelaySeconds > 0 {
+			job.RunAt = job.Created + item.DelaySeconds
+		}
+		job.IdempotencyKey = item.IdempotencyKey
+		jobs[i].QueueName = item.QueueName
+		jobs[i].Job = job
+	}
 
-	if err = a.control.AddJob(job, body.QueueName, accessKey, false); err != nil {
+	results, err := a.controller(r).AddJobs(jobs, accessKey, body.Atomic)
+	if err != nil {
+		errStr := err.Error()
+		switch {
+		case errStr == "Invalid Args":
+			returnStatusCode(http.StatusBadRequest, w)
+		case errStr == "Bulk Failed":
+			// nothing was added, the results show which jobs are invalid
+			if err = returnResponseBody(http.StatusBadRequest, &AddJobsResponse{Results: results}, w, a.json); err != nil {
+				returnInternalServerError(err, w, r, a.json)
+			}
+		default:
+			returnInternalServerError(err, w, r, a.json)
+		}
+		return
+	}
+
+	status := http.StatusCreated
+	updated := make(map[string]bool)
+	queueNames := make([]string, 0)
+	for _, result := range results {
+		if len(result.Error) > 0 {
+			status = http.StatusOK
+		} else if !updated[result.QueueName] {
+			updated[result.QueueName] = true
+			queueNames = append(queueNames, result.QueueName)
+			a.controller(r).UpdateQueue(result.QueueName)
+		}
+	}
+
+	if !commitChanges(a.monitor, w, r, a.json, syncDurability(a.controller(r), queueNames...)) {
+		return
+	}
+	if err = returnResponseBody(status, &AddJobsResponse{Results: results}, w, a.json); err != nil {
+		returnInternalServerError(err, w, r, a.json)
+	}
+}
+
+// ApplyJobOperation is an endpoint handler for changing every job in a queue that matches a filter in a single request
+func (a *HTTPAPI) ApplyJobOperation(w http.ResponseWriter, r *http.Request) {
+	accessKey := r.Header.Get("X-Access-Key")
+	body := new(JobOperationRequest)
+	err := getRequestBody(body, r, a.json)
+	if len(accessKey) == 0 || err != nil {
+		returnStatusCode(http.StatusBadRequest, w)
+		return
+	}
+
+	logJob(r, body.QueueName, "")
+	body.Op = strings.ToLower(body.Op)
+	affected, err := a.controller(r).ApplyJobOperation(&body.JobOperation, body.QueueName, accessKey, body.DryRun)
+	if err != nil {
 		errStr := err.Error()
 		switch {
 		case errStr == "Invalid Args":
@@ -187,15 +466,18 @@ func (a *HTTPAPI) AddJob(w http.ResponseWriter, r *http.Request) {
 		case errStr == "Not Found":
 			returnStatusCode(http.StatusNotFound, w)
 		default:
-			returnInternalServerError(err, w, a.json)
+			returnInternalServerError(err, w, r, a.json)
 		}
 		return
 	}
 
-	a.control.UpdateQueue(body.QueueName)
-	a.monitor.Write()
-	if err = returnResponseBody(http.StatusCreated, job, w, a.json); err != nil {
-		returnInternalServerError(err, w, a.json)
+	if !body.DryRun && affected > 0 {
+		if !commitChanges(a.monitor, w, r, a.json, syncDurability(a.controller(r), body.QueueName)) {
+			return
+		}
+	}
+	if err = returnResponseBody(http.StatusOK, &JobOperationResponse{Affected: affected, DryRun: body.DryRun}, w, a.json); err != nil {
+		returnInternalServerError(err, w, r, a.json)
 	}
 }
 
@@ -210,11 +492,11 @@ func (a *HTTPAPI) GetJob(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// regardless whether the user has access, we should use this time to update the queue
-	if !updateQueue(queueName, a.control, w, a.json, a.monitor) {
+	if !updateQueue(queueName, a.controller(r), w, r, a.json, a.monitor) {
 		return
 	}
 
-	job, err := a.control.GetJob(uid, queueName, accessKey)
+	job, err := a.controller(r).GetJob(uid, queueName, accessKey)
 	if err != nil {
 		errStr := err.Error()
 		switch {
@@ -223,7 +505,7 @@ func (a *HTTPAPI) GetJob(w http.ResponseWriter, r *http.Request) {
 		case errStr == "Unauthorized":
 			returnStatusCode(http.StatusUnauthorized, w)
 		default:
-			returnInternalServerError(err, w, a.json)
+			returnInternalServerError(err, w, r, a.json)
 		}
 		return
 	} else if job == nil {
@@ -232,26 +514,142 @@ func (a *HTTPAPI) GetJob(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := returnResponseBody(http.StatusOK, job, w, a.json); err != nil {
-		returnInternalServerError(err, w, a.json)
+		returnInternalServerError(err, w, r, a.json)
+		return
+	}
+}
+
+// ListJobs is a handler for returning a page of the jobs in a queue matching a filter, in the requested order
+func (a *HTTPAPI) ListJobs(w http.ResponseWriter, r *http.Request) {
+	accessKey := r.Header.Get("X-Access-Key")
+	queueName := r.URL.Query().Get("queueName")
+	limit, err := getQueryInt(r, "limit")
+	if len(queueName) == 0 || len(accessKey) == 0 || err != nil {
+		returnStatusCode(http.StatusBadRequest, w)
+		return
+	}
+
+	filter, err := getJobFilter(r, a.json)
+	if err != nil {
+		returnStatusCode(http.StatusBadRequest, w)
+		return
+	}
+
+	// regardless whether the user has access, we should use this time to update the queue
+	if !updateQueue(queueName, a.controller(r), w, r, a.json, a.monitor) {
 		return
 	}
+
+	query := &database.JobQuery{
+		Filter: filter,
+		Sort:   strings.ToLower(r.URL.Query().Get("sort")),
+		Limit:  int(limit),
+		Cursor: r.URL.Query().Get("cursor"),
+	}
+
+	page, err := a.controller(r).ListJobs(query, queueName, accessKey)
+	if err != nil {
+		errStr := err.Error()
+		switch {
+		case errStr == "Invalid Args":
+			returnStatusCode(http.StatusBadRequest, w)
+		case errStr == "Unauthorized":
+			returnStatusCode(http.StatusUnauthorized, w)
+		case errStr == "Not Found":
+			returnStatusCode(http.StatusNotFound, w)
+		default:
+			returnInternalServerError(err, w, r, a.json)
+		}
+		return
+	}
+
+	if err = returnResponseBody(http.StatusOK, page, w, a.json); err != nil {
+		returnInternalServerError(err, w, r, a.json)
+	}
 }
 
 // GetNextJob is a handler for returning the next job from the queue head that is queued
 func (a *HTTPAPI) GetNextJob(w http.ResponseWriter, r *http.Request) {
 	accessKey := r.Header.Get("X-Access-Key")
 	queueName := r.URL.Query().Get("queueName")
-	if len(queueName) == 0 || len(accessKey) == 0 {
+	leaseSeconds, err := getQueryInt(r, "leaseSeconds")
+	if len(queueName) == 0 || len(accessKey) == 0 || err != nil {
 		returnStatusCode(http.StatusBadRequest, w)
 		return
 	}
 
+	wait, err := getQueryInt(r, "wait")
+	if err != nil || wait < 0 {
+		returnStatusCode(http.StatusBadRequest, w)
+		return
+	} else if wait > maxWaitSeconds {
+		wait = maxWaitSeconds
+	}
+
+	// a count claims a batch of jobs, which are returned as a list even if only one is avalible
+	markQueued := r.URL.Query().Get("markQueued")
+	claim := len(markQueued) > 0 && strings.ToLower(markQueued) == "true"
+	batch := len(r.URL.Query().Get("count")) > 0
+	count, err := getQueryInt(r, "count")
+	if err != nil || count < 0 || (batch && (count == 0 || !claim)) {
+		returnStatusCode(http.StatusBadRequest, w)
+		return
+	} else if count > maxClaimCount {
+		count = maxClaimCount
+	} else if count == 0 {
+		count = 1
+	}
+
 	// regardless whether the user has access, we should use this time to update the queue
-	if !updateQueue(queueName, a.control, w, a.json, a.monitor) {
+	if !updateQueue(queueName, a.controller(r), w, r, a.json, a.monitor) {
 		return
 	}
 
-	job, err := a.control.GetNextJob(queueName, accessKey)
+	deadline := time.Now().Add(time.Duration(wait) * time.Second)
+	if requestDeadline, ok := r.Context().Deadline(); ok && requestDeadline.Add(-waitMargin).Before(deadline) {
+		deadline = requestDeadline.Add(-waitMargin)
+	}
+
+	// lease the jobs to the caller if the flag is set, default don't update
+	var jobs []*database.Job
+	var leases []*database.Lease
+	for {
+		// taken before checking the queue, so a job added in between still wakes the request
+		available := a.controller(r).WaitForJob(queueName)
+
+		if claim {
+			jobs, leases, err = a.controller(r).ClaimNextJobs(queueName, accessKey, int(count), leaseSeconds)
+		} else if job, getErr := a.controller(r).GetNextJob(queueName, accessKey); job != nil {
+			jobs, err = []*database.Job{job}, getErr
+		} else {
+			err = getErr
+		}
+
+		remaining := time.Until(deadline)
+		if err != nil || len(jobs) > 0 || remaining <= 0 {
+			break
+		} else if remaining > waitRecheck {
+			remaining = waitRecheck
+		}
+
+		timer := time.NewTimer(remaining)
+		select {
+		case <-available:
+		case <-timer.C:
+		case <-a.closing:
+			// the API is shutting down, check the queue a last time rather than keep the request open
+			deadline = time.Now()
+		case <-r.Context().Done():
+			// the client has gone or the request timed out, nothing has been taken from the queue
+			timer.Stop()
+			return
+		}
+		timer.Stop()
+
+		// changes from the update are kept with the next write rather than written on every check
+		a.controller(r).UpdateQueue(queueName)
+	}
+
 	if err != nil {
 		errStr := err.Error()
 		switch {
@@ -259,31 +657,43 @@ func (a *HTTPAPI) GetNextJob(w http.ResponseWriter, r *http.Request) {
 			returnStatusCode(http.StatusBadRequest, w)
 		case errStr == "Unauthorized":
 			returnStatusCode(http.StatusUnauthorized, w)
+		case errStr == "Not Found":
+			returnStatusCode(http.StatusNotFound, w)
 		default:
-			returnInternalServerError(err, w, a.json)
+			returnInternalServerError(err, w, r, a.json)
 		}
 		return
-	} else if job == nil {
+	} else if len(jobs) == 0 {
 		returnStatusCode(http.StatusNoContent, w)
 		return
 	}
 
-	// update the job status if the flag is set, default don't update
-	markQueued := r.URL.Query().Get("markQueued")
-	if len(markQueued) > 0 && strings.ToLower(markQueued) == "true" {
-		if err := a.control.UpdateJobStatus(job.UID, database.Inprogress, queueName, accessKey); err != nil {
-			returnInternalServerError(err, w, a.json)
+	if len(jobs) == 1 {
+		logJob(r, "", jobs[0].UID)
+	}
+
+	responses := make([]*NextJobResponse, len(jobs))
+	for i, job := range jobs {
+		responses[i] = &NextJobResponse{Job: job}
+		if claim {
+			responses[i].Lease = leases[i]
+		}
+	}
+
+	if claim {
+		if !commitChanges(a.monitor, w, r, a.json, syncDurability(a.controller(r), queueName)) {
 			return
 		}
-		job.State = database.Inprogress
-		a.monitor.Write()
 	}
 
-	if err := returnResponseBody(http.StatusOK, job, w, a.json); err != nil {
-		returnInternalServerError(err, w, a.json)
+	var body interface{} = responses[0]
+	if batch {
+		body = &NextJobsResponse{Jobs: responses}
+	}
+	if err := returnResponseBody(http.StatusOK, body, w, a.json); err != nil {
+		returnInternalServerError(err, w, r, a.json)
 		return
 	}
-
 }
 
 // UpdateJobStatus is a handler for updating the status of a given job
@@ -299,13 +709,14 @@ func (a *HTTPAPI) UpdateJobStatus(w http.ResponseWriter, r *http.Request) {
 		returnStatusCode(http.StatusBadRequest, w)
 		return
 	}
+	logJob(r, body.QueueName, body.UID)
 
 	// regardless whether the user has access, we should use this time to update the queue
-	if !updateQueue(body.QueueName, a.control, w, a.json, a.monitor) {
+	if !updateQueue(body.QueueName, a.controller(r), w, r, a.json, a.monitor) {
 		return
 	}
 
-	if err := a.control.UpdateJobStatus(body.UID, strings.ToLower(body.NewStatus), body.QueueName, accessKey); err != nil {
+	if err := a.controller(r).UpdateJobStatus(body.UID, strings.ToLower(body.NewStatus), body.LeaseToken, body.Error, body.QueueName, accessKey); err != nil {
 		errStr := err.Error()
 		switch {
 		case errStr == "Invalid Args":
@@ -314,16 +725,66 @@ func (a *HTTPAPI) UpdateJobStatus(w http.ResponseWriter, r *http.Request) {
 			returnStatusCode(http.StatusUnauthorized, w)
 		case errStr == "Not Found":
 			returnStatusCode(http.StatusNotFound, w)
+		case errStr == "Invalid Lease", errStr == "Job Exists", errStr == "Job Blocked":
+			returnStatusCode(http.StatusConflict, w)
 		default:
-			returnInternalServerError(err, w, a.json)
+			returnInternalServerError(err, w, r, a.json)
 		}
 		return
 	}
 
-	a.monitor.Write()
+	if !commitChanges(a.monitor, w, r, a.json, syncDurability(a.controller(r), body.QueueName)) {
+		return
+	}
 	returnStatusCode(http.StatusOK, w)
 }
 
+// Heartbeat is a handler for extending the lease a worker holds on an inprogress job
+func (a *HTTPAPI) Heartbeat(w http.ResponseWriter, r *http.Request) {
+	accessKey := r.Header.Get("X-Access-Key")
+	if len(accessKey) == 0 {
+		returnStatusCode(http.StatusBadRequest, w)
+		return
+	}
+
+	body := new(HeartbeatRequest)
+	if err := getRequestBody(body, r, a.json); err != nil {
+		returnStatusCode(http.StatusBadRequest, w)
+		return
+	}
+	logJob(r, body.QueueName, body.UID)
+
+	// regardless whether the user has access, we should use this time to update the queue
+	if !updateQueue(body.QueueName, a.controller(r), w, r, a.json, a.monitor) {
+		return
+	}
+
+	lease, err := a.controller(r).ExtendLease(body.UID, body.LeaseToken, body.LeaseSeconds, body.QueueName, accessKey)
+	if err != nil {
+		errStr := err.Error()
+		switch {
+		case errStr == "Invalid Args":
+			returnStatusCode(http.StatusBadRequest, w)
+		case errStr == "Unauthorized":
+			returnStatusCode(http.StatusUnauthorized, w)
+		case errStr == "Not Found":
+			returnStatusCode(http.StatusNotFound, w)
+		case errStr == "Invalid Lease":
+			returnStatusCode(http.StatusConflict, w)
+		default:
+			returnInternalServerError(err, w, r, a.json)
+		}
+		return
+	}
+
+	if !commitChanges(a.monitor, w, r, a.json, syncDurability(a.controller(r), body.QueueName)) {
+		return
+	}
+	if err = returnResponseBody(http.StatusOK, lease, w, a.json); err != nil {
+		returnInternalServerError(err, w, r, a.json)
+	}
+}
+
 // DeleteJob is a handler for deleting a job entry
 func (a *HTTPAPI) DeleteJob(w http.ResponseWriter, r *http.Request) {
 	accessKey := r.Header.Get("X-Access-Key")
@@ -335,11 +796,201 @@ func (a *HTTPAPI) DeleteJob(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// regardless whether the user has access, we should use this time to update the queue
-	if !updateQueue(queueName, a.control, w, a.json, a.monitor) {
+	if !updateQueue(queueName, a.controller(r), w, r, a.json, a.monitor) {
+		return
+	}
+
+	if err := a.controller(r).DeleteJob(uid, queueName, accessKey); err != nil {
+		errStr := err.Error()
+		switch {
+		case errStr == "Invalid Args":
+			returnStatusCode(http.StatusBadRequest, w)
+		case errStr == "Unauthorized":
+			returnStatusCode(http.StatusUnauthorized, w)
+		case errStr == "Not Found":
+			returnStatusCode(http.StatusNotFound, w)
+		default:
+			returnInternalServerError(err, w, r, a.json)
+		}
+		return
+	}
+
+	if !commitChanges(a.monitor, w, r, a.json, syncDurability(a.controller(r), queueName)) {
+		return
+	}
+	returnStatusCode(http.StatusNoContent, w)
+}
+
+// RejectJob is a handler for failing a job without further attempts, moving it to the dead-letter queue if one is set
+func (a *HTTPAPI) RejectJob(w http.ResponseWriter, r *http.Request) {
+	accessKey := r.Header.Get("X-Access-Key")
+	if len(accessKey) == 0 {
+		returnStatusCode(http.StatusBadRequest, w)
+		return
+	}
+
+	body := new(RejectJobRequest)
+	if err := getRequestBody(body, r, a.json); err != nil {
+		returnStatusCode(http.StatusBadRequest, w)
+		return
+	}
+	logJob(r, body.QueueName, body.UID)
+
+	// regardless whether the user has access, we should use this time to update the queue
+	if !updateQueue(body.QueueName, a.controller(r), w, r, a.json, a.monitor) {
+		return
+	}
+
+	if err := a.controller(r).RejectJob(body.UID, body.LeaseToken, body.Reason, body.QueueName, accessKey); err != nil {
+		errStr := err.Error()
+		switch {
+		case errStr == "Invalid Args":
+			returnStatusCode(http.StatusBadRequest, w)
+		case errStr == "Unauthorized":
+			returnStatusCode(http.StatusUnauthorized, w)
+		case errStr == "Not Found":
+			returnStatusCode(http.StatusNotFound, w)
+		case errStr == "Invalid Lease":
+			returnStatusCode(http.StatusConflict, w)
+		default:
+			returnInternalServerError(err, w, r, a.json)
+		}
+		return
+	}
+
+	if !commitChanges(a.monitor, w, r, a.json, syncDurability(a.controller(r), body.QueueName)) {
+		return
+	}
+	returnStatusCode(http.StatusOK, w)
+}
+
+// GetDeadLetterJobs is a handler for listing the jobs moved from a queue to its dead-letter queue
+func (a *HTTPAPI) GetDeadLetterJobs(w http.ResponseWriter, r *http.Request) {
+	accessKey := r.Header.Get("X-Access-Key")
+	queueName := r.URL.Query().Get("queueName")
+	if len(queueName) == 0 || len(accessKey) == 0 {
+		returnStatusCode(http.StatusBadRequest, w)
+		return
+	}
+
+	// regardless whether the user has access, we should use this time to update the queue
+	if !updateQueue(queueName, a.controller(r), w, r, a.json, a.monitor) {
+		return
+	}
+
+	jobs, err := a.controller(r).GetDeadLetterJobs(queueName, accessKey)
+	if err != nil {
+		errStr := err.Error()
+		switch {
+		case errStr == "Invalid Args":
+			returnStatusCode(http.StatusBadRequest, w)
+		case errStr == "Unauthorized":
+			returnStatusCode(http.StatusUnauthorized, w)
+		case errStr == "Not Found", errStr == "No Dead Letter Queue":
+			returnStatusCode(http.StatusNotFound, w)
+		default:
+			returnInternalServerError(err, w, r, a.json)
+		}
+		return
+	}
+
+	if err = returnResponseBody(http.StatusOK, &DeadLetterResponse{Jobs: jobs}, w, a.json); err != nil {
+		returnInternalServerError(err, w, r, a.json)
+	}
+}
+
+// RedriveJobs is a handler for moving dead-lettered jobs back into the queue they came from
+func (a *HTTPAPI) RedriveJobs(w http.ResponseWriter, r *http.Request) {
+	accessKey := r.Header.Get("X-Access-Key")
+	body := new(RedriveRequest)
+	err := getRequestBody(body, r, a.json)
+	if len(accessKey) == 0 || err != nil || (len(body.UIDs) == 0 && !body.All) || (len(body.UIDs) > 0 && body.All) {
+		returnStatusCode(http.StatusBadRequest, w)
+		return
+	}
+
+	logJob(r, body.QueueName, "")
+	redriven, err := a.controller(r).RedriveJobs(body.UIDs, body.QueueName, accessKey)
+	if err != nil {
+		errStr := err.Error()
+		switch {
+		case errStr == "Invalid Args":
+			returnStatusCode(http.StatusBadRequest, w)
+		case errStr == "Unauthorized":
+			returnStatusCode(http.StatusUnauthorized, w)
+		case errStr == "Not Found", errStr == "No Dead Letter Queue":
+			returnStatusCode(http.StatusNotFound, w)
+		case errStr == "Job Exists":
+			returnStatusCode(http.StatusConflict, w)
+		default:
+			returnInternalServerError(err, w, r, a.json)
+		}
+		return
+	}
+
+	if !commitChanges(a.monitor, w, r, a.json, syncDurability(a.controller(r), body.QueueName)) {
+		return
+	}
+	if err = returnResponseBody(http.StatusOK, &RedriveResponse{Redriven: redriven}, w, a.json); err != nil {
+		returnInternalServerError(err, w, r, a.json)
+	}
+}
+
+// CreateSchedule is an endpoint handler for adding a recurring job schedule to a queue
+func (a *HTTPAPI) CreateSchedule(w http.ResponseWriter, r *http.Request) {
+	accessKey := r.Header.Get("X-Access-Key")
+	body := new(CreateScheduleRequest)
+	err := getRequestBody(body, r, a.json)
+	if len(accessKey) == 0 || err != nil {
+		returnStatusCode(http.StatusBadRequest, w)
+		return
+	}
+	logJob(r, body.QueueName, "")
+
+	schedule := &database.Schedule{
+		Name:     body.Name,
+		Cron:     body.Cron,
+		Timezone: body.Timezone,
+		CatchUp:  strings.ToLower(body.CatchUp),
+		Job:      body.Job,
+	}
+
+	if err = a.controller(r).CreateSchedule(schedule, body.QueueName, accessKey); err != nil {
+		errStr := err.Error()
+		switch {
+		case errStr == "Invalid Args":
+			returnStatusCode(http.StatusBadRequest, w)
+		case errStr == "Unauthorized":
+			returnStatusCode(http.StatusUnauthorized, w)
+		case errStr == "Not Found":
+			returnStatusCode(http.StatusNotFound, w)
+		case errStr == "Schedule Exists":
+			returnStatusCode(http.StatusConflict, w)
+		default:
+			returnInternalServerError(err, w, r, a.json)
+		}
+		return
+	}
+
+	if !commitChanges(a.monitor, w, r, a.json, syncDurability(a.controller(r), body.QueueName)) {
+		return
+	}
+	if err = returnResponseBody(http.StatusCreated, schedule, w, a.json); err != nil {
+		returnInternalServerError(err, w, r, a.json)
+	}
+}
+
+// GetSchedules is an endpoint handler for listing the schedules of a queue
+func (a *HTTPAPI) GetSchedules(w http.ResponseWriter, r *http.Request) {
+	accessKey := r.Header.Get("X-Access-Key")
+	queueName := r.URL.Query().Get("queueName")
+	if len(queueName) == 0 || len(accessKey) == 0 {
+		returnStatusCode(http.StatusBadRequest, w)
 		return
 	}
 
-	if err := a.control.DeleteJob(uid, queueName, accessKey); err != nil {
+	schedules, err := a.controller(r).GetSchedules(queueName, accessKey)
+	if err != nil {
 		errStr := err.Error()
 		switch {
 		case errStr == "Invalid Args":
@@ -349,11 +1000,162 @@ func (a *HTTPAPI) DeleteJob(w http.ResponseWriter, r *http.Request) {
 		case errStr == "Not Found":
 			returnStatusCode(http.StatusNotFound, w)
 		default:
-			returnInternalServerError(err, w, a.json)
+			returnInternalServerError(err, w, r, a.json)
 		}
 		return
 	}
 
-	a.monitor.Write()
+	if err = returnResponseBody(http.StatusOK, &GetSchedulesResponse{Schedules: schedules}, w, a.json); err != nil {
+		returnInternalServerError(err, w, r, a.json)
+	}
+}
+
+// DeleteSchedule is an endpoint handler for removing a schedule from a queue
+func (a *HTTPAPI) DeleteSchedule(w http.ResponseWriter, r *http.Request) {
+	accessKey := r.Header.Get("X-Access-Key")
+	queueName := r.URL.Query().Get("queueName")
+	name := r.URL.Query().Get("name")
+	if len(name) == 0 || len(queueName) == 0 || len(accessKey) == 0 {
+		returnStatusCode(http.StatusBadRequest, w)
+		return
+	}
+
+	if err := a.controller(r).DeleteSchedule(name, queueName, accessKey); err != nil {
+		errStr := err.Error()
+		switch {
+		case errStr == "Invalid Args":
+			returnStatusCode(http.StatusBadRequest, w)
+		case errStr == "Unauthorized":
+			returnStatusCode(http.StatusUnauthorized, w)
+		case errStr == "Not Found":
+			returnStatusCode(http.StatusNotFound, w)
+		default:
+			returnInternalServerError(err, w, r, a.json)
+		}
+		return
+	}
+
+	if !commitChanges(a.monitor, w, r, a.json, syncDurability(a.controller(r), queueName)) {
+		return
+	}
 	returnStatusCode(http.StatusNoContent, w)
 }
+
+// AddWorkflow is an endpoint handler for adding a set of dependent jobs across queues in a single operation
+func (a *HTTPAPI) AddWorkflow(w http.ResponseWriter, r *http.Request) {
+	accessKey := r.Header.Get("X-Access-Key")
+	body := new(AddWorkflowRequest)
+	err := getRequestBody(body, r, a.json)
+	if len(accessKey) == 0 || err != nil || len(body.Jobs) == 0 {
+		returnStatusCode(http.StatusBadRequest, w)
+		return
+	}
+
+	workflow := &database.Workflow{ID: uuid.New().String(), Jobs: body.Jobs}
+	currentTime := time.Now().Unix()
+	for _, item := range workflow.Jobs {
+		if item == nil || item.Job == nil {
+			returnStatusCode(http.StatusBadRequest, w)
+			return
+		}
+		newJob(r.Context(), item.Job, currentTime)
+	}
+
+	added, err := a.controller(r).AddWorkflow(workflow, accessKey)
+	if err != nil {
+		errStr := err.Error()
+		switch {
+		case errStr == "Invalid Args":
+			returnStatusCode(http.StatusBadRequest, w)
+		case errStr == "Unauthorized":
+			returnStatusCode(http.StatusUnauthorized, w)
+		case errStr == "Not Found":
+			returnStatusCode(http.StatusNotFound, w)
+		case errStr == "Job Exists":
+			returnStatusCode(http.StatusConflict, w)
+		default:
+			returnInternalServerError(err, w, r, a.json)
+		}
+		return
+	}
+
+	queueNames := make([]string, len(workflow.Jobs))
+	for i, item := range workflow.Jobs {
+		queueNames[i] = item.QueueName
+	}
+	if !commitChanges(a.monitor, w, r, a.json, syncDurability(a.controller(r), queueNames...)) {
+		return
+	}
+	if err = returnResponseBody(http.StatusCreated, added, w, a.json); err != nil {
+		returnInternalServerError(err, w, r, a.json)
+	}
+}
+
+// GetWorkflow is an endpoint handler for querying the status of a workflow
+func (a *HTTPAPI) GetWorkflow(w http.ResponseWriter, r *http.Request) {
+	accessKey := r.Header.Get("X-Access-Key")
+	queueName := r.URL.Query().Get("queueName")
+	workflowID := r.URL.Query().Get("workflowID")
+	if len(workflowID) == 0 || len(queueName) == 0 || len(accessKey) == 0 {
+		returnStatusCode(http.StatusBadRequest, w)
+		return
+	}
+
+	status, err := a.controller(r).GetWorkflow(workflowID, queueName, accessKey)
+	if err != nil {
+		errStr := err.Error()
+		switch {
+		case errStr == "Invalid Args":
+			returnStatusCode(http.StatusBadRequest, w)
+		case errStr == "Unauthorized":
+			returnStatusCode(http.StatusUnauthorized, w)
+		case errStr == "Not Found":
+			returnStatusCode(http.StatusNotFound, w)
+		default:
+			returnInternalServerError(err, w, r, a.json)
+		}
+		return
+	}
+
+	if err = returnResponseBody(http.StatusOK, status, w, a.json); err != nil {
+		returnInternalServerError(err, w, r, a.json)
+	}
+}
+
+// GetStats is an endpoint handler for returning the job counts and timings of a queue, or of every queue the access key
+// is valid for if no queue is given
+func (a *HTTPAPI) GetStats(w http.ResponseWriter, r *http.Request) {
+	accessKey := r.Header.Get("X-Access-Key")
+	queueName := r.URL.Query().Get("queueName")
+	if len(accessKey) == 0 {
+		returnStatusCode(http.StatusBadRequest, w)
+		return
+	}
+
+	var stats interface{}
+	var err error
+	if len(queueName) > 0 {
+		stats, err = a.controller(r).GetQueueStats(queueName, accessKey)
+	} else {
+		stats, err = a.controller(r).GetAllStats(accessKey)
+	}
+
+	if err != nil {
+		errStr := err.Error()
+		switch {
+		case errStr == "Invalid Args":
+			returnStatusCode(http.StatusBadRequest, w)
+		case errStr == "Unauthorized":
+			returnStatusCode(http.StatusUnauthorized, w)
+		case errStr == "Not Found":
+			returnStatusCode(http.StatusNotFound, w)
+		default:
+			returnInternalServerError(err, w, r, a.json)
+		}
+		return
+	}
+
+	if err = returnResponseBody(http.StatusOK, stats, w, a.json); err != nil {
+		returnInternalServerError(err, w, r, a.json)
+	}
+}
@@ -0,0 +1,206 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MichaelWittgreffe/jobengine/pkg/crypto"
+	"github.com/MichaelWittgreffe/jobengine/pkg/database"
+	"github.com/MichaelWittgreffe/jobengine/pkg/filesystem"
+	"github.com/MichaelWittgreffe/jobengine/pkg/logger"
+	"github.com/MichaelWittgreffe/jobengine/pkg/tracing"
+	"github.com/google/uuid"
+)
+
+// testKey is the access key of the queues created by the tests
+const testKey string = "test-key"
+
+// newTestServer returns a server for the API over a new database saved to a temporary directory, holding the given
+// queues each with testKey. The server and the monitor are stopped once the test finishes
+func newTestServer(t *testing.T, queueNames ...string) (*httptest.Server, database.QueryController) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "jobengine")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := logger.NewLogger("text", "error")
+	db := database.NewDBFile()
+	encrypt := crypto.NewEncryptionHandler("0123456789abcdef0123456789abcdef", "AES", crypto.NewHashHandler("md5"))
+	fileHandler := database.NewDBFileHandler("fs", encrypt, database.NewDBDataHandler("json"), filesystem.NewFileSystem("os"))
+	monitor := database.NewDBFileMonitor(db, filepath.Join(dir, "jobengine.db"), fileHandler, log, 10*time.Millisecond, 100*time.Millisecond)
+	controller := database.NewQueryController(db, crypto.NewHashHandler("sha512"), log)
+	for _, name := range queueNames {
+		if err = controller.CreateQueue(name, testKey, nil); err != nil {
+			t.Fatalf("CreateQueue(%s): %s", name, err)
+		}
+	}
+
+	go monitor.Start()
+	server := httptest.NewServer(NewHTTPAPI(log, monitor, controller, tracing.NewTracer("jobengine", nil)).router)
+	t.Cleanup(func() {
+		server.Close()
+		monitor.Stop(context.Background())
+		os.RemoveAll(dir)
+	})
+	return server, controller
+}
+
+// sendRequest sends a request with testKey to the server, with the given body if it is not empty
+func sendRequest(server *httptest.Server, method, path, body string) (*http.Response, error) {
+	req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Access-Key", testKey)
+	return http.DefaultClient.Do(req)
+}
+
+func TestGetNextJobConcurrentClaims(t *testing.T) {
+	const jobCount = 200
+	const workers = 16
+
+	server, controller := newTestServer(t, "queue")
+	for i := 0; i < jobCount; i++ {
+		job := &database.Job{UID: uuid.New().String(), State: database.Queued}
+		if _, _, err := controller.AddJob(job, "queue", testKey); err != nil {
+			t.Fatalf("AddJob: %s", err)
+		}
+	}
+
+	var lock sync.Mutex
+	claimed := make(map[string]int)
+	errs := make(chan error, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				resp, err := sendRequest(server, http.MethodGet, "/api/v1/job/next?queueName=queue&markQueued=true&leaseSeconds=60", "")
+				if err != nil {
+					errs <- err
+					return
+				}
+				body := new(NextJobResponse)
+				err = json.NewDecoder(resp.Body).Decode(body)
+				resp.Body.Close()
+
+				if resp.StatusCode == http.StatusNoContent {
+					return
+				} else if resp.StatusCode != http.StatusOK || err != nil || body.Job == nil {
+					errs <- fmt.Errorf("unexpected response %d: %v", resp.StatusCode, err)
+					return
+				}
+
+				lock.Lock()
+				claimed[body.UID]++
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+	if len(claimed) != jobCount {
+		t.Errorf("%d jobs claimed, want %d", len(claimed), jobCount)
+	}
+	for uid, count := range claimed {
+		if count != 1 {
+			t.Errorf("job %s claimed %d times", uid, count)
+		}
+	}
+}
+
+func TestAddJobConcurrentClaims(t *testing.T) {
+	const adds = 400
+	const claimers = 8
+
+	server, _ := newTestServer(t, "queue")
+	requests := []struct {
+		path string
+		body string
+	}{
+		{path: "/api/v1/job", body: `{"queue_name": "queue", "job": {"priority": 1}}`},
+		{path: "/api/v1/workflow", body: `{"jobs": [{"ref": "a", "queue_name": "queue", "job": {}}, {"ref": "b", "queue_name": "queue", "job": {}}]}`},
+	}
+
+	// the added jobs are claimed while the responses adding them are written, which must not read the jobs claimed
+	done := make(chan struct{})
+	var claiming sync.WaitGroup
+	for i := 0; i < claimers; i++ {
+		claiming.Add(1)
+		go func() {
+			defer claiming.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if resp, err := sendRequest(server, http.MethodGet, "/api/v1/job/next?queueName=queue&markQueued=true", ""); err == nil {
+					resp.Body.Close()
+				}
+			}
+		}()
+	}
+
+	var wg sync.WaitGroup
+	for _, request := range requests {
+		wg.Add(1)
+		go func(path, body string) {
+			defer wg.Done()
+			for i := 0; i < adds; i++ {
+				resp, err := sendRequest(server, http.MethodPut, path, body)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusCreated {
+					t.Errorf("PUT %s: status %d, want %d", path, resp.StatusCode, http.StatusCreated)
+					return
+				}
+			}
+		}(request.path, request.body)
+	}
+	wg.Wait()
+	close(done)
+	claiming.Wait()
+}
+
+func TestGetNextJobWaitsBeyondRequestTimeout(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits longer than the request timeout")
+	}
+
+	server, _ := newTestServer(t, "queue")
+	wait := requestTimeout + time.Second
+	started := time.Now()
+	resp, err := sendRequest(server, http.MethodGet, fmt.Sprintf("/api/v1/job/next?queueName=queue&wait=%d", int(wait.Seconds())), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("status %d, want %d", resp.StatusCode, http.StatusNoContent)
+	}
+	if elapsed := time.Since(started); elapsed < wait-waitRecheck {
+		t.Errorf("responded after %s, want the full wait of %s", elapsed, wait)
+	}
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/MichaelWittgreffe/jobengine/pkg/logger"
+)
+
+// requestLog is the logger of a single request, the queue and job it is for are added once the handler knows them
+type requestLog struct {
+	lock   sync.Mutex
+	logger logger.Logger
+}
+
+// newRequestLog is a constructor for a requestLog logging through the given logger
+func newRequestLog(base logger.Logger) *requestLog {
+	return &requestLog{logger: base}
+}
+
+// setJob adds the given queue and job to every message logged for the request, empty values are ignored
+func (l *requestLog) setJob(queueName, uid string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if len(queueName) > 0 {
+		l.logger = l.logger.With(logger.F("queue", queueName))
+	}
+	if len(uid) > 0 {
+		l.logger = l.logger.With(logger.F("uid", uid))
+	}
+}
+
+// current returns the logger with the fields set so far
+func (l *requestLog) current() logger.Logger {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.logger
+}
+
+// Debug logs a message with the fields of the request
+func (l *requestLog) Debug(msg string, fields ...logger.Field) error {
+	return l.current().Debug(msg, fields...)
+}
+
+// Info logs a message with the fields of the request
+func (l *requestLog) Info(msg string, fields ...logger.Field) error {
+	return l.current().Info(msg, fields...)
+}
+
+// Warn logs a message with the fields of the request
+func (l *requestLog) Warn(msg string, fields ...logger.Field) error {
+	return l.current().Warn(msg, fields...)
+}
+
+// Error logs a message with the fields of the request
+func (l *requestLog) Error(msg string, fields ...logger.Field) error {
+	return l.current().Error(msg, fields...)
+}
+
+// Fatal logs a message with the fields of the request and exits the application
+func (l *requestLog) Fatal(msg string, fields ...logger.Field) error {
+	return l.current().Fatal(msg, fields...)
+}
+
+// With returns a logger adding the given fields to the fields of the request set so far
+func (l *requestLog) With(fields ...logger.Field) logger.Logger {
+	return l.current().With(fields...)
+}
+
+// logJob adds the given queue and job to every message logged for the request, empty values are ignored
+func logJob(r *http.Request, queueName, uid string) {
+	if requestLog, ok := logger.FromContext(r.Context()).(*requestLog); ok {
+		requestLog.setJob(queueName, uid)
+	}
+}
@@ -6,17 +6,75 @@ import "github.com/MichaelWittgreffe/jobengine/pkg/database"
 type CreateQueueRequest struct {
 	Name      string `json:"name"`
 	AccessKey string `json:"access_key"`
+	database.QueueOptions
 }
 
 // AddJobRequest represents the request body for the add job endpoint
 type AddJobRequest struct {
-	Job       *database.Job `json:"job"`
-	QueueName string        `json:"queue_name"`
+	Job            *database.Job `json:"job"`
+	QueueName      string        `json:"queue_name"`
+	DelaySeconds   int64         `json:"delay_seconds"`
+	IdempotencyKey string        `json:"idempotency_key"`
+}
+
+// AddJobsRequest represents the request body for adding many jobs in a single request, each job as for a single add.
+// If atomic is set either every job is added or none are
+type AddJobsRequest struct {
+	Jobs   []*AddJobRequest `json:"jobs"`
+	Atomic bool             `json:"atomic"`
+}
+
+// JobOperationRequest represents the request body for changing every job in a queue matching a filter, nothing is
+// changed if dry run is set
+type JobOperationRequest struct {
+	QueueName string `json:"queue_name"`
+	DryRun    bool   `json:"dry_run"`
+	database.JobOperation
 }
 
 // UpdateJobStatusRequest represents the request body for the update job endpoint
 type UpdateJobStatusRequest struct {
-	QueueName string `json:"queue_name"`
-	UID       string `json:"uid"`
-	NewStatus string `json:"new_status"`
+	QueueName  string `json:"queue_name"`
+	UID        string `json:"uid"`
+	NewStatus  string `json:"new_status"`
+	LeaseToken string `json:"lease_token"`
+	Error      string `json:"error"`
+}
+
+// HeartbeatRequest represents the request body for the job heartbeat endpoint
+type HeartbeatRequest struct {
+	QueueName    string `json:"queue_name"`
+	UID          string `json:"uid"`
+	LeaseToken   string `json:"lease_token"`
+	LeaseSeconds int64  `json:"lease_seconds"`
+}
+
+// RejectJobRequest represents the request body for the reject job endpoint
+type RejectJobRequest struct {
+	QueueName  string `json:"queue_name"`
+	UID        string `json:"uid"`
+	LeaseToken string `json:"lease_token"`
+	Reason     string `json:"reason"`
+}
+
+// RedriveRequest represents the request body for the dead-letter redrive endpoint
+type RedriveRequest struct {
+	QueueName string   `json:"queue_name"`
+	UIDs      []string `json:"uids"`
+	All       bool     `json:"all"`
+}
+
+// CreateScheduleRequest represents the request body for the create schedule endpoint
+type CreateScheduleRequest struct {
+	QueueName string        `json:"queue_name"`
+	Name      string        `json:"name"`
+	Cron      string        `json:"cron"`
+	Timezone  string        `json:"timezone"`
+	CatchUp   string        `json:"catch_up"`
+	Job       *database.Job `json:"job"`
+}
+
+// AddWorkflowRequest represents the request body for adding a workflow of dependent jobs
+type AddWorkflowRequest struct {
+	Jobs []*database.WorkflowJob `json:"jobs"`
 }
@@ -12,4 +12,42 @@ type GetQueueResponse struct {
 	Jobs []*database.Job `json:"jobs"`
 	Size int             `json:"size"`
 	Name string          `json:"name"`
+	database.QueueOptions
+}
+
+// NextJobResponse is a response object for the Get Next Job endpoint, includes the lease if the job was marked 'inprogress'
+type NextJobResponse struct {
+	*database.Job
+	Lease *database.Lease `json:"lease,omitempty"`
+}
+
+// AddJobsResponse is a response object for the bulk Add Jobs endpoint, holding a result for each job in the order given
+type AddJobsResponse struct {
+	Results []*database.BulkResult `json:"results"`
+}
+
+// JobOperationResponse is a response object for the bulk Job Operation endpoint
+type JobOperationResponse struct {
+	Affected int  `json:"affected"`
+	DryRun   bool `json:"dry_run"`
+}
+
+// NextJobsResponse is a response object for the Get Next Job endpoint when a batch of jobs is claimed
+type NextJobsResponse struct {
+	Jobs []*NextJobResponse `json:"jobs"`
+}
+
+// DeadLetterResponse is a response object for the Get Dead Letter Jobs endpoint
+type DeadLetterResponse struct {
+	Jobs []*database.Job `json:"jobs"`
+}
+
+// RedriveResponse is a response object for the Redrive endpoint
+type RedriveResponse struct {
+	Redriven int `json:"redriven"`
+}
+
+// GetSchedulesResponse is a response object for the Get Schedules endpoint
+type GetSchedulesResponse struct {
+	Schedules []*database.Schedule `json:"schedules"`
 }
@@ -1,12 +1,19 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/MichaelWittgreffe/jobengine/pkg/database"
+	"github.com/MichaelWittgreffe/jobengine/pkg/logger"
+	"github.com/MichaelWittgreffe/jobengine/pkg/tracing"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/google/uuid"
 )
 
 // getRequestBody marshals the incoming request body into the given object pointer
@@ -22,6 +29,97 @@ func getRequestBody(bodyObj interface{}, r *http.Request, json *database.JSONDat
 	return err
 }
 
+// getQueryInt parses the given query parameter as an integer, returns 0 if the parameter is not present
+func getQueryInt(r *http.Request, name string) (int64, error) {
+	value := r.URL.Query().Get(name)
+	if len(value) == 0 {
+		return 0, nil
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// getJobFilter builds a job filter from the query parameters of the request. States are given as a comma separated list
+// and content fields as 'content.<path>=<value>', where the value is compared as JSON if it is valid JSON or as a string
+func getJobFilter(r *http.Request, json *database.JSONDataHandler) (*database.JobFilter, error) {
+	filter := &database.JobFilter{Content: make(map[string]interface{})}
+	query := r.URL.Query()
+
+	if states := query.Get("state"); len(states) > 0 {
+		filter.States = strings.Split(strings.ToLower(states), ",")
+	}
+
+	times := map[string]*int64{
+		"createdAfter":  &filter.CreatedAfter,
+		"createdBefore": &filter.CreatedBefore,
+		"updatedAfter":  &filter.UpdatedAfter,
+		"updatedBefore": &filter.UpdatedBefore,
+	}
+	for name, field := range times {
+		value, err := getQueryInt(r, name)
+		if err != nil {
+			return nil, err
+		}
+		*field = value
+	}
+
+	priorities := map[string]**int{
+		"minPriority": &filter.MinPriority,
+		"maxPriority": &filter.MaxPriority,
+	}
+	for name, field := range priorities {
+		if len(query.Get(name)) == 0 {
+			continue
+		}
+		value, err := strconv.Atoi(query.Get(name))
+		if err != nil {
+			return nil, err
+		}
+		*field = &value
+	}
+
+	for name, values := range query {
+		if !strings.HasPrefix(name, "content.") || len(values) == 0 {
+			continue
+		}
+
+		var value interface{}
+		if err := json.Decode([]byte(values[0]), &value); err != nil {
+			value = values[0]
+		}
+		filter.Content[strings.TrimPrefix(name, "content.")] = value
+	}
+
+	return filter, nil
+}
+
+// newJob sets up the given job from a request body to be added as a new 'queued' job, clearing any fields that are only
+// set by the database
+func newJob(ctx context.Context, job *database.Job, currentTime int64) *database.Job {
+	job.Created = currentTime
+	job.LastUpdated = currentTime
+	job.State = database.Queued
+	job.UID = uuid.New().String()
+	job.LeaseKey = ""
+	job.LeaseExpires = 0
+	job.Attempts = 0
+	job.NotBefore = 0
+	job.RetryHistory = nil
+	job.SourceQueue = ""
+	job.FailureReason = ""
+	job.ScheduleName = ""
+	job.WorkflowID = ""
+	job.IdempotencyKey = ""
+	job.TraceParent = ""
+	job.TraceState = ""
+
+	// the job carries the trace of the request adding it, so the worker processing it can continue the trace
+	if span := tracing.FromContext(ctx); span != nil {
+		job.TraceParent = span.Context.TraceParent()
+		job.TraceState = span.Context.TraceState
+	}
+	return job
+}
+
 // returnResponseBody unmarshals the given object into the http response and sets the content type
 func returnResponseBody(statusCode int, bodyObj interface{}, w http.ResponseWriter, json *database.JSONDataHandler) error {
 	w.Header().Add("Content-Type", "application/json")
@@ -46,8 +144,12 @@ func returnStatusCode(code int, w http.ResponseWriter) {
 	w.WriteHeader(code)
 }
 
-// returnInternalServerError sets up the response writer with an Internal Server Error response
-func returnInternalServerError(err error, w http.ResponseWriter, json *database.JSONDataHandler) error {
+// returnInternalServerError sets up the response writer with an Internal Server Error response, logging the error
+func returnInternalServerError(err error, w http.ResponseWriter, r *http.Request, json *database.JSONDataHandler) error {
+	if requestLogger := logger.FromContext(r.Context()); requestLogger != nil {
+		requestLogger.Error("Error Handling Request", logger.F("error", err))
+	}
+
 	w.WriteHeader(http.StatusInternalServerError)
 	if result, err := json.Encode(ErrorResponse{Err: err.Error()}); err == nil {
 		w.Write(result)
@@ -58,7 +160,7 @@ func returnInternalServerError(err error, w http.ResponseWriter, json *database.
 }
 
 // updateQueue performs an update and file write on the queue, returns true on success, false on failure with error response already setup
-func updateQueue(queueName string, c database.QueryController, w http.ResponseWriter, j *database.JSONDataHandler, m database.DBMonitor) bool {
+func updateQueue(queueName string, c database.QueryController, w http.ResponseWriter, r *http.Request, j *database.JSONDataHandler, m database.DBMonitor) bool {
 	if err := c.UpdateQueue(queueName); err != nil {
 		errStr := err.Error()
 		switch {
@@ -67,7 +169,7 @@ func updateQueue(queueName string, c database.QueryController, w http.ResponseWr
 		case errStr == "Not Found":
 			returnStatusCode(http.StatusNotFound, w)
 		default:
-			returnInternalServerError(err, w, j)
+			returnInternalServerError(err, w, r, j)
 		}
 		return false
 	}
@@ -75,3 +177,48 @@ func updateQueue(queueName string, c database.QueryController, w http.ResponseWr
 	m.Write()
 	return true
 }
+
+// commitChanges requests the changes made by the request are written to the database, waiting for them to be written if
+// sync is set or the client set the X-Sync-Commit header to 'true'. Returns true on success, false on failure with error
+// response already setup
+func commitChanges(m database.DBMonitor, w http.ResponseWriter, r *http.Request, j *database.JSONDataHandler, sync bool) bool {
+	if !sync && strings.ToLower(r.Header.Get("X-Sync-Commit")) != "true" {
+		m.Write()
+		return true
+	}
+
+	if err := m.Commit(r.Context()); err != nil {
+		returnInternalServerError(fmt.Errorf("Changes Not Saved: %s", err), w, r, j)
+		return false
+	}
+	return true
+}
+
+// syncDurability returns whether any of the given queues acknowledge changes only once they are saved
+func syncDurability(c database.QueryController, queueNames ...string) bool {
+	for _, queueName := range queueNames {
+		if c.Durability(queueName) == database.DurabilitySync {
+			return true
+		}
+	}
+	return false
+}
+
+// routePattern returns the route the request matched, the pattern rather than the path is used so ids in the path are
+// not recorded
+func routePattern(r *http.Request) string {
+	if routeContext := chi.RouteContext(r.Context()); routeContext != nil {
+		if route := routeContext.RoutePattern(); len(route) > 0 {
+			return route
+		}
+	}
+	return "unmatched"
+}
+
+// responseStatus returns the status code written to the response, a response written without one is a 200
+func responseStatus(writer middleware.WrapResponseWriter) int {
+	if status := writer.Status(); status != 0 {
+		return status
+	}
+	return http.StatusOK
+}
@@ -0,0 +1,197 @@
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSearchYears is how far ahead Next searches for an activation before giving up, e.g. for '0 0 30 2 *'
+const maxSearchYears int = 5
+
+// macros maps the supported '@' shorthands to their standard expression
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// monthNames maps the three letter month names to their value
+var monthNames = map[string]int{
+	"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+	"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12,
+}
+
+// dayNames maps the three letter day names to their value
+var dayNames = map[string]int{
+	"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6,
+}
+
+// field defines the range and names supported by a single field of an expression
+type field struct {
+	min   int
+	max   int
+	names map[string]int
+}
+
+// Expression represents a parsed standard 5 field cron expression (minute hour day-of-month month day-of-week)
+type Expression struct {
+	minute  uint64
+	hour    uint64
+	dom     uint64
+	month   uint64
+	dow     uint64
+	domStar bool
+	dowStar bool
+}
+
+// Parse parses the given cron expression, supporting '*', lists, ranges, steps, month/day names and '@' macros
+func Parse(expr string) (*Expression, error) {
+	expr = strings.TrimSpace(expr)
+	if macro, found := macros[strings.ToLower(expr)]; found {
+		expr = macro
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("Expected 5 Fields, Found %d", len(fields))
+	}
+
+	result := new(Expression)
+	var err error
+	if result.minute, err = parseField(fields[0], field{min: 0, max: 59}); err != nil {
+		return nil, fmt.Errorf("Invalid Minute: %s", err.Error())
+	}
+	if result.hour, err = parseField(fields[1], field{min: 0, max: 23}); err != nil {
+		return nil, fmt.Errorf("Invalid Hour: %s", err.Error())
+	}
+	if result.dom, err = parseField(fields[2], field{min: 1, max: 31}); err != nil {
+		return nil, fmt.Errorf("Invalid Day Of Month: %s", err.Error())
+	}
+	if result.month, err = parseField(fields[3], field{min: 1, max: 12, names: monthNames}); err != nil {
+		return nil, fmt.Errorf("Invalid Month: %s", err.Error())
+	}
+	// 7 is accepted as sunday, along with 0
+	if result.dow, err = parseField(fields[4], field{min: 0, max: 7, names: dayNames}); err != nil {
+		return nil, fmt.Errorf("Invalid Day Of Week: %s", err.Error())
+	}
+	if result.dow&(1<<7) != 0 {
+		result.dow |= 1
+	}
+
+	result.domStar = fields[2] == "*" || fields[2] == "?"
+	result.dowStar = fields[4] == "*" || fields[4] == "?"
+	return result, nil
+}
+
+// Next returns the first activation of the expression strictly after the given time, in the location of the given time.
+// Returns the zero time if the expression never activates
+func (e *Expression) Next(from time.Time) time.Time {
+	loc := from.Location()
+	t := from.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(maxSearchYears, 0, 0)
+
+	for t.Before(limit) {
+		previous := t
+		switch {
+		case e.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !e.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case e.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case e.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+
+		// daylight saving changes can normalise a date back onto or before the time it was advanced from
+		if !t.After(previous) {
+			t = previous.Truncate(time.Hour).Add(time.Hour)
+		}
+	}
+
+	return time.Time{}
+}
+
+// dayMatches returns whether the day of the given time matches, if both day fields are restricted either may match
+func (e *Expression) dayMatches(t time.Time) bool {
+	domMatch := e.dom&(1<<uint(t.Day())) != 0
+	dowMatch := e.dow&(1<<uint(t.Weekday())) != 0
+
+	if e.domStar || e.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// parseField parses a comma separated list of values, ranges and steps into a bitset of the values it matches
+func parseField(value string, f field) (uint64, error) {
+	var result uint64
+
+	for _, part := range strings.Split(value, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			parsedStep, err := strconv.Atoi(part[i+1:])
+			if err != nil || parsedStep <= 0 {
+				return 0, fmt.Errorf("Invalid Step %s", part[i+1:])
+			}
+			step = parsedStep
+			part = part[:i]
+		}
+
+		start, end := f.min, f.max
+		switch {
+		case part == "*" || part == "?":
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if start, err = parseValue(bounds[0], f); err != nil {
+				return 0, err
+			}
+			if end, err = parseValue(bounds[1], f); err != nil {
+				return 0, err
+			}
+			if start > end {
+				return 0, fmt.Errorf("Invalid Range %s", part)
+			}
+		default:
+			parsedValue, err := parseValue(part, f)
+			if err != nil {
+				return 0, err
+			}
+			start = parsedValue
+			if step == 1 {
+				end = parsedValue
+			}
+		}
+
+		for i := start; i <= end; i += step {
+			result |= 1 << uint(i)
+		}
+	}
+
+	return result, nil
+}
+
+// parseValue parses a single number or name within the bounds of the field
+func parseValue(value string, f field) (int, error) {
+	if f.names != nil {
+		if named, found := f.names[strings.ToUpper(value)]; found {
+			return named, nil
+		}
+	}
+
+	result, err := strconv.Atoi(value)
+	if err != nil || result < f.min || result > f.max {
+		return 0, fmt.Errorf("Invalid Value %s", value)
+	}
+
+	return result, nil
+}
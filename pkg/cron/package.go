@@ -0,0 +1,4 @@
+/*
+Package cron parses cron expressions and calculates when they next activate
+*/
+package cron
@@ -8,6 +8,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"hash"
+	"sync"
 )
 
 // HashHandler implements a hashing processor interface
@@ -32,12 +33,13 @@ func NewHashHandler(algorithm string) HashHandler {
 		return nil
 	}
 
-	return &HashProcess{hasher: hasher}
+	return &HashProcess{hasher: hasher, lock: new(sync.Mutex)}
 }
 
-// HashProcess is an object for performing hash functions on strings
+// HashProcess is an object for performing hash functions on strings, safe for concurrent use
 type HashProcess struct {
 	hasher hash.Hash
+	lock   *sync.Mutex
 }
 
 // Process performs the configured hash function on the given input string
@@ -46,6 +48,8 @@ func (hs *HashProcess) Process(input string) (string, error) {
 		return "", fmt.Errorf("Invalid Arg")
 	}
 
+	hs.lock.Lock()
+	defer hs.lock.Unlock()
 	defer hs.hasher.Reset()
 
 	_, err := hs.hasher.Write([]byte(input))
@@ -0,0 +1,137 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// BulkJob represents a single job within a bulk add, jobs in the same request may be added to different queues
+type BulkJob struct {
+	QueueName string `json:"queue_name"`
+	Job       *Job   `json:"job"`
+}
+
+// BulkResult represents the outcome of a single job within a bulk add, the UID is of the original job if an existing
+// job was returned for its idempotency key or unique fields
+type BulkResult struct {
+	QueueName string `json:"queue_name"`
+	UID       string `json:"uid,omitempty"`
+	Created   bool   `json:"created"`
+	Error     string `json:"error,omitempty"`
+}
+
+// AddJobs adds the given jobs holding the locks of every queue they use, returning a result for each in the same order.
+// Jobs that fail are reported in their result and do not stop the others being added, unless atomic is set where either
+// every job is added or none are and "Bulk Failed" is returned alongside the results
+func (c *QueryControl) AddJobs(jobs []*BulkJob, accessKey string, atomic bool) ([]*BulkResult, error) {
+	if len(jobs) == 0 || len(accessKey) == 0 {
+		return nil, fmt.Errorf("Invalid Args")
+	}
+
+	hashedKey, err := c.hash.Process(accessKey)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(jobs))
+	for _, item := range jobs {
+		if item != nil {
+			names = append(names, item.QueueName)
+			names = append(names, dependencyQueues(item.Job)...)
+		}
+	}
+	defer c.lockQueues(false, names...)()
+
+	results := make([]*BulkResult, len(jobs))
+	for i, item := range jobs {
+		results[i] = new(BulkResult)
+		if item != nil {
+			results[i].QueueName = item.QueueName
+		}
+	}
+
+	if atomic && !c.checkBulkJobs(jobs, results, hashedKey) {
+		return results, fmt.Errorf("Bulk Failed")
+	}
+
+	currentTime := time.Now().Unix()
+	for i, item := range jobs {
+		queue, err := c.bulkQueue(item, hashedKey)
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+
+		existing, err := c.addJob(queue, item.Job, currentTime)
+		switch {
+		case err != nil:
+			results[i].Error = err.Error()
+		case existing != nil:
+			results[i].UID = existing.UID
+		default:
+			results[i].UID = item.Job.UID
+			results[i].Created = true
+		}
+	}
+
+	return results, nil
+}
+
+// bulkQueue returns the queue the given job is to be added to, once the job and access key are checked - must handle Lock
+// outside of this function
+func (c *QueryControl) bulkQueue(item *BulkJob, hashedKey string) (*Queue, error) {
+	if item == nil || item.Job == nil || len(item.QueueName) == 0 || !validJob(item.Job) {
+		return nil, fmt.Errorf("Invalid Args")
+	}
+
+	queue, found := c.db.Queues[item.QueueName]
+	if !found {
+		return nil, fmt.Errorf("Not Found")
+	} else if queue.AccessKey != hashedKey {
+		return nil, fmt.Errorf("Unauthorized")
+	}
+	return queue, nil
+}
+
+// checkBulkJobs checks every job in a bulk add would be added without changing the database, recording the error against
+// the result of each job that would fail. Jobs are checked against each other as well as the jobs already held - must
+// handle Lock outside of this function
+func (c *QueryControl) checkBulkJobs(jobs []*BulkJob, results []*BulkResult, hashedKey string) bool {
+	currentTime := time.Now().Unix()
+	idempotencyKeys := make(map[[2]string]bool)
+	uniqueKeys := make(map[[2]string]bool)
+	valid := true
+
+	for i, item := range jobs {
+		queue, err := c.bulkQueue(item, hashedKey)
+		if err == nil && !c.validateDependencies(item.Job, nil) {
+			err = fmt.Errorf("Invalid Args")
+		}
+		if err != nil {
+			results[i].Error = err.Error()
+			valid = false
+			continue
+		}
+
+		// a repeated idempotency key returns the original job, so is never rejected
+		if key := item.Job.IdempotencyKey; len(key) > 0 {
+			if idempotencyKeys[[2]string{queue.Name, key}] || c.findIdempotentJob(queue, key, currentTime) != nil {
+				continue
+			}
+			idempotencyKeys[[2]string{queue.Name, key}] = true
+		}
+
+		if queue.UniqueConflict == UniqueMerge {
+			continue
+		} else if key, ok := queue.uniqueKey(item.Job); ok {
+			if uniqueKeys[[2]string{queue.Name, key}] || queue.uniqueConflict(item.Job) != nil {
+				results[i].Error = "Job Exists"
+				valid = false
+				continue
+			}
+			uniqueKeys[[2]string{queue.Name, key}] = true
+		}
+	}
+
+	return valid
+}
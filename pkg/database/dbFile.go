@@ -1,17 +1,126 @@
 package database
 
-import "sync"
+import (
+	"sync"
+	"time"
+)
 
 // DBFile represents an entire database file
 type DBFile struct {
-	lock   *sync.Mutex
-	Queues map[string]*Queue `json:"queues"`
+	lock        *sync.RWMutex
+	shared      *sync.Mutex
+	journal     []*WALEntry
+	dependents  map[string][]*dependentRef
+	resolutions []*resolution
+	waiters     map[string]chan struct{}
+	Queues      map[string]*Queue `json:"queues"`
 }
 
 // NewDBFile is a constructor for DBFile
 func NewDBFile() *DBFile {
 	return &DBFile{
-		Queues: make(map[string]*Queue),
-		lock:   new(sync.Mutex),
+		Queues:      make(map[string]*Queue),
+		lock:        new(sync.RWMutex),
+		shared:      new(sync.Mutex),
+		journal:     make([]*WALEntry, 0),
+		dependents:  make(map[string][]*dependentRef),
+		resolutions: make([]*resolution, 0),
+		waiters:     make(map[string]chan struct{}),
 	}
 }
+
+// record appends a mutation to the journal of changes since the last save if it is saved, keeping the counters of the
+// queue up to date and waking anything waiting on it if a job is now 'queued' - must handle Lock of the queue outside of
+// this function
+func (db *DBFile) record(entry *WALEntry) {
+	db.trackStats(entry)
+	db.trackOrder(entry)
+	persisted := db.persisted(entry)
+
+	db.shared.Lock()
+	defer db.shared.Unlock()
+
+	if persisted {
+		db.journal = append(db.journal, entry)
+	}
+	if (entry.Op == WALPutJob && entry.Job.State == Queued) || entry.Op == WALDeleteQueue {
+		db.notify(entry.QueueName)
+	}
+}
+
+// takeJournal returns the journal of changes since the last save and resets it
+func (db *DBFile) takeJournal() []*WALEntry {
+	db.shared.Lock()
+	defer db.shared.Unlock()
+
+	journal := db.journal
+	db.journal = make([]*WALEntry, 0)
+	return journal
+}
+
+// buildIndexes rebuilds the lookups held alongside the queues, after they are loaded - must handle Lock outside of this
+// function
+func (db *DBFile) buildIndexes() {
+	db.shared.Lock()
+	defer db.shared.Unlock()
+
+	db.dependents = make(map[string][]*dependentRef)
+	for _, queue := range db.Queues {
+		queue.lock = new(sync.Mutex)
+		queue.buildKeyOrder()
+		queue.buildStats()
+		queue.buildIndex()
+		queue.uniqueJobs = make(map[string]*Job)
+		for _, job := range queue.Jobs {
+			queue.indexUnique(job)
+			if job.State != Blocked {
+				continue
+			}
+			for _, dependency := range job.DependsOn {
+				if dependency.waiting(job) {
+					db.dependents[dependency.UID] = append(db.dependents[dependency.UID], &dependentRef{queueName: queue.Name, uid: job.UID})
+				}
+			}
+		}
+	}
+
+	db.resolveFinished()
+}
+
+// resolveFinished records the outcome of parents that finished without it being resolved against the jobs blocked on
+// them, such as a parent that was saved as finished before its dependents were. They are resolved once the queues are
+// next locked - must handle Lock and shared Lock outside of this function
+func (db *DBFile) resolveFinished() {
+	currentTime := time.Now().Unix()
+	for uid, refs := range db.dependents {
+		for _, ref := range refs {
+			child := db.Queues[ref.queueName].lookup(ref.uid)
+			if outcome, finished := db.parentOutcome(child, uid); finished {
+				db.resolutions = append(db.resolutions, &resolution{uid: uid, outcome: outcome, currentTime: currentTime})
+				break
+			}
+		}
+	}
+}
+
+// parentOutcome returns the outcome of the parent with the given UID of the blocked job, false if it has not finished or
+// its outcome is already recorded against the job - must handle Lock outside of this function
+func (db *DBFile) parentOutcome(job *Job, uid string) (string, bool) {
+	for _, dependency := range job.DependsOn {
+		if dependency.UID != uid || len(dependency.State) > 0 {
+			continue
+		}
+
+		var parent *Job
+		if queue, found := db.Queues[dependency.QueueName]; found {
+			parent = queue.lookup(uid)
+		}
+		switch {
+		case parent == nil, parent.State == Failed, parent.State == DeadLettered:
+			return Failed, true
+		case parent.State == Complete:
+			return Complete, true
+		}
+	}
+	return "", false
+}
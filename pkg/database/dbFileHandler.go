@@ -2,6 +2,8 @@ package database
 
 import (
 	"fmt"
+	"path/filepath"
+	"sync"
 
 	"github.com/MichaelWittgreffe/jobengine/pkg/crypto"
 	"github.com/MichaelWittgreffe/jobengine/pkg/filesystem"
@@ -11,6 +13,7 @@ import (
 type DBFileHandler interface {
 	SaveToFile(dbFile *DBFile, filePath string) error
 	LoadFromFile(dbFile *DBFile, filePath string) error
+	FileSize(filePath string) (int64, error)
 }
 
 // NewDBFileHandler is a factory function for creating a derived instance of the DBFileHandler interface. Performs a hash on the given key to ensure size
@@ -19,12 +22,22 @@ func NewDBFileHandler(dbFileHandleType string, encryptHandler crypto.EncryptionH
 		return nil
 	}
 
+	snapshotHandler := &FSFileHandler{
+		encrypt: encryptHandler,
+		data:    dataHandler,
+		file:    fileHandler,
+	}
+
 	switch {
 	case dbFileHandleType == "fs":
-		return &FSFileHandler{
-			encrypt: encryptHandler,
-			data:    dataHandler,
-			file:    fileHandler,
+		return snapshotHandler
+	case dbFileHandleType == "wal":
+		return &WALFileHandler{
+			encrypt:      encryptHandler,
+			data:         dataHandler,
+			file:         fileHandler,
+			snapshot:     snapshotHandler,
+			compactAfter: defaultWALCompactAfter,
 		}
 	default:
 		return nil
@@ -36,51 +49,115 @@ type FSFileHandler struct {
 	encrypt crypto.EncryptionHandler
 	data    DBDataHandler
 	file    filesystem.FileSystem
+	saving  sync.Mutex
+	failed  bool
 }
 
-// SaveToFile saves the given dbFile to the given filePath, applies lock
+// SaveToFile saves the given dbFile to the given filePath, applies lock. The database is only locked while it is
+// encoded, it is encrypted and written once released so requests are not held up by the disk
 func (h *FSFileHandler) SaveToFile(dbFile *DBFile, filePath string) error {
 	if dbFile == nil || len(filePath) == 0 {
 		return fmt.Errorf("Invalid Args")
 	}
 
+	h.saving.Lock()
+	defer h.saving.Unlock()
+
+	exists, err := h.file.FileExists(filePath)
+	exists = exists && err == nil
+
+	dbFile.lock.Lock()
+	// the whole file is written, so the changes since the last save do not need keeping. Once a save fails the file is
+	// behind the database whatever the journal holds, so it is written again
+	if journal := dbFile.takeJournal(); len(journal) == 0 && exists && !h.failed {
+		dbFile.lock.Unlock()
+		return nil
+	}
+	encodedData, err := h.encodeSnapshot(dbFile)
+	dbFile.lock.Unlock()
+
+	if err != nil {
+		h.failed = true
+		return err
+	}
+
+	err = h.writeSnapshot(encodedData, filePath)
+	h.failed = err != nil
+	return err
+}
+
+// LoadFromFile loads the given filePath database into the given dbFile object, applies lock
+func (h *FSFileHandler) LoadFromFile(dbFile *DBFile, filePath string) error {
+	if dbFile == nil || len(filePath) == 0 {
+		return fmt.Errorf("Invalid Args")
+	}
+
 	dbFile.lock.Lock()
 	defer dbFile.lock.Unlock()
 
-	if exists, err := h.file.FileExists(filePath); exists && err == nil {
-		if err = h.file.DeleteFile(filePath); err != nil {
-			return fmt.Errorf("Error Deleting Existing DBFile: %s", err.Error())
-		}
-	} else if err != nil {
-		return fmt.Errorf("Error Checking DBFile Existence: %s", err.Error())
+	if err := h.readSnapshot(dbFile, filePath); err != nil {
+		return err
 	}
 
-	encodedData, err := h.data.Encode(dbFile)
+	dbFile.buildIndexes()
+	return nil
+}
+
+// FileSize returns the size in bytes of the database at filePath
+func (h *FSFileHandler) FileSize(filePath string) (int64, error) {
+	return h.file.FileSize(filePath)
+}
+
+// encodeSnapshot encodes the full contents of dbFile, without the jobs of in-memory queues - must handle Lock outside of
+// this function
+func (h *FSFileHandler) encodeSnapshot(dbFile *DBFile) ([]byte, error) {
+	encodedData, err := h.data.Encode(dbFile.persistent())
 	if err != nil {
-		return fmt.Errorf("Failed Encoding Data: %s", err)
+		return nil, fmt.Errorf("Failed Encoding Data: %s", err)
 	}
+	return encodedData, nil
+}
 
+// writeSnapshot encrypts and writes the encoded snapshot to filePath. The data is written and synced to a temporary file
+// which is then renamed over filePath, so the previous snapshot survives a failure
+func (h *FSFileHandler) writeSnapshot(encodedData []byte, filePath string) error {
 	encryptedData, err := h.encrypt.Encrypt(encodedData)
 	if err != nil {
 		return fmt.Errorf("Failed Encrypting Data: %s", err)
 	}
 
-	if err = h.file.WriteFile(filePath, encryptedData); err != nil {
+	tempPath := snapshotTempPath(filePath)
+	if err = h.file.WriteFile(tempPath, encryptedData); err != nil {
+		h.removeTempFile(tempPath)
 		return fmt.Errorf("Failed To Save DBFile: %s", err.Error())
 	}
 
+	if err = h.file.SyncFile(tempPath); err != nil {
+		h.removeTempFile(tempPath)
+		return fmt.Errorf("Failed To Sync DBFile: %s", err.Error())
+	}
+
+	if err = h.file.Rename(tempPath, filePath); err != nil {
+		h.removeTempFile(tempPath)
+		return fmt.Errorf("Failed To Replace DBFile: %s", err.Error())
+	}
+
+	if err = h.file.SyncDir(filepath.Dir(filePath)); err != nil {
+		return fmt.Errorf("Failed To Sync DBFile Directory: %s", err.Error())
+	}
+
 	return nil
 }
 
-// LoadFromFile loads the given filePath database into the given dbFile object, applies lock
-func (h *FSFileHandler) LoadFromFile(dbFile *DBFile, filePath string) error {
-	if dbFile == nil || len(filePath) == 0 {
-		return fmt.Errorf("Invalid Args")
+// removeTempFile cleans up a partially written snapshot, errors are ignored as the file is overwritten by the next save
+func (h *FSFileHandler) removeTempFile(tempPath string) {
+	if exists, err := h.file.FileExists(tempPath); exists && err == nil {
+		h.file.DeleteFile(tempPath)
 	}
+}
 
-	dbFile.lock.Lock()
-	defer dbFile.lock.Unlock()
-
+// readSnapshot loads the full contents of filePath into dbFile - must handle Lock outside of this function
+func (h *FSFileHandler) readSnapshot(dbFile *DBFile, filePath string) error {
 	if exists, err := h.file.FileExists(filePath); !exists && err == nil {
 		return fmt.Errorf("DBFile Not Found At Path %s", filePath)
 	} else if err != nil {
@@ -104,3 +181,8 @@ func (h *FSFileHandler) LoadFromFile(dbFile *DBFile, filePath string) error {
 
 	return nil
 }
+
+// snapshotTempPath returns the path a new snapshot is written to before it replaces the one at filePath
+func snapshotTempPath(filePath string) string {
+	return filePath + ".tmp"
+}
@@ -0,0 +1,104 @@
+package database
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/MichaelWittgreffe/jobengine/pkg/filesystem"
+)
+
+// faultyFileSystem is the os file system with the operation named by fail returning an error
+type faultyFileSystem struct {
+	filesystem.FileSystem
+	fail string
+}
+
+func (f *faultyFileSystem) fault(op string) error {
+	if f.fail == op {
+		return fmt.Errorf("injected %s failure", op)
+	}
+	return nil
+}
+
+func (f *faultyFileSystem) WriteFile(filepath string, data []byte) error {
+	if err := f.fault("WriteFile"); err != nil {
+		return err
+	}
+	return f.FileSystem.WriteFile(filepath, data)
+}
+
+func (f *faultyFileSystem) SyncFile(filepath string) error {
+	if err := f.fault("SyncFile"); err != nil {
+		return err
+	}
+	return f.FileSystem.SyncFile(filepath)
+}
+
+func (f *faultyFileSystem) Rename(oldpath, newpath string) error {
+	if err := f.fault("Rename"); err != nil {
+		return err
+	}
+	return f.FileSystem.Rename(oldpath, newpath)
+}
+
+func (f *faultyFileSystem) SyncDir(dirpath string) error {
+	if err := f.fault("SyncDir"); err != nil {
+		return err
+	}
+	return f.FileSystem.SyncDir(dirpath)
+}
+
+func TestFSFileHandlerSaveFailure(t *testing.T) {
+	tests := []struct {
+		fail     string
+		replaced bool
+	}{
+		{fail: "WriteFile"},
+		{fail: "SyncFile"},
+		{fail: "Rename"},
+		// the new snapshot has already replaced the old one, only its durability is in doubt
+		{fail: "SyncDir", replaced: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.fail, func(t *testing.T) {
+			path := newTestPath(t)
+			db, controller := newTestController(t, "queue")
+			saved := addTestJobs(t, controller, "queue", 1, 0)[0]
+			if err := newTestFileHandler(t, "fs", nil).SaveToFile(db, path); err != nil {
+				t.Fatalf("SaveToFile: %s", err)
+			}
+
+			unsaved := addTestJobs(t, controller, "queue", 1, 0)[0]
+			fileSystem := &faultyFileSystem{FileSystem: filesystem.NewFileSystem("os"), fail: test.fail}
+			handler := newTestFileHandler(t, "fs", fileSystem)
+			if err := handler.SaveToFile(db, path); err == nil {
+				t.Fatalf("SaveToFile succeeded with %s failing", test.fail)
+			}
+
+			loaded := NewDBFile()
+			if err := newTestFileHandler(t, "fs", nil).LoadFromFile(loaded, path); err != nil {
+				t.Fatalf("LoadFromFile after failed save: %s", err)
+			}
+			if loaded.Queues["queue"].lookup(saved) == nil {
+				t.Errorf("job saved before the failure not loaded")
+			}
+			if replaced := loaded.Queues["queue"].lookup(unsaved) != nil; replaced != test.replaced {
+				t.Errorf("snapshot replaced = %t, want %t", replaced, test.replaced)
+			}
+
+			// nothing has changed since the failed save, the next save must still write the database
+			fileSystem.fail = ""
+			if err := handler.SaveToFile(db, path); err != nil {
+				t.Fatalf("SaveToFile after failure: %s", err)
+			}
+			loaded = NewDBFile()
+			if err := newTestFileHandler(t, "fs", nil).LoadFromFile(loaded, path); err != nil {
+				t.Fatalf("LoadFromFile: %s", err)
+			}
+			if loaded.Queues["queue"].lookup(unsaved) == nil {
+				t.Errorf("job added before the failed save not loaded once saved")
+			}
+		})
+	}
+}
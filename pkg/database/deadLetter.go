@@ -0,0 +1,195 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/MichaelWittgreffe/jobengine/pkg/logger"
+)
+
+// RejectJob fails the given job without further attempts, moving it to the queues dead-letter queue if one is set. The
+// lease token must be given if the job is leased by a worker
+func (c *QueryControl) RejectJob(uid, leaseToken, reason, queueName, accessKey string) error {
+	if len(uid) == 0 || len(queueName) == 0 || len(accessKey) == 0 {
+		return fmt.Errorf("Invalid Args")
+	}
+
+	hashedKey, err := c.hash.Process(accessKey)
+	if err != nil {
+		return err
+	}
+
+	defer c.lockQueues(true, queueName)()
+
+	queue, found := c.db.Queues[queueName]
+	if !found {
+		return fmt.Errorf("Not Found")
+	} else if queue.AccessKey != hashedKey {
+		return fmt.Errorf("Unauthorized")
+	}
+
+	job := queue.lookup(uid)
+	if job == nil {
+		return fmt.Errorf("Not Found")
+	} else if err = c.checkLease(job, leaseToken); err != nil {
+		return err
+	}
+
+	currentTime := time.Now().Unix()
+	job.RetryHistory = append(job.RetryHistory, &RetryRecord{
+		Attempt: job.Attempts,
+		Failed:  currentTime,
+		Error:   reason,
+	})
+	job.State = Failed
+	job.LeaseKey = ""
+	job.LeaseExpires = 0
+	job.LastUpdated = currentTime
+	c.db.record(newJobEntry(queueName, job))
+	c.resolveDependents(uid, Failed, currentTime)
+
+	c.deadLetterJob(queue, job, reason, currentTime)
+	return nil
+}
+
+// GetDeadLetterJobs returns the jobs moved from the given queue to its dead-letter queue
+func (c *QueryControl) GetDeadLetterJobs(queueName, accessKey string) ([]*Job, error) {
+	if len(queueName) == 0 || len(accessKey) == 0 {
+		return nil, fmt.Errorf("Invalid Args")
+	}
+
+	hashedKey, err := c.hash.Process(accessKey)
+	if err != nil {
+		return nil, err
+	}
+
+	defer c.lockQueues(true, queueName)()
+
+	queue, found := c.db.Queues[queueName]
+	if !found {
+		return nil, fmt.Errorf("Not Found")
+	} else if queue.AccessKey != hashedKey {
+		return nil, fmt.Errorf("Unauthorized")
+	}
+
+	deadLetterQueue, found := c.db.Queues[queue.DeadLetterQueue]
+	if !found {
+		return nil, fmt.Errorf("No Dead Letter Queue")
+	}
+
+	result := make([]*Job, 0)
+	for _, job := range deadLetterQueue.ordered() {
+		if job.State == DeadLettered && job.SourceQueue == queueName {
+			result = append(result, job.copy())
+		}
+	}
+
+	return result, nil
+}
+
+// RedriveJobs moves the given jobs from the dead-letter queue back into the given queue as 'queued' with their attempts
+// reset, all jobs dead-lettered from the queue are moved if uids is empty. A job matching the unique fields of an active
+// job in the queue is left dead-lettered, given uids are not redriven if any would be. Returns the number of jobs
+// redriven
+func (c *QueryControl) RedriveJobs(uids []string, queueName, accessKey string) (int, error) {
+	if len(queueName) == 0 || len(accessKey) == 0 {
+		return 0, fmt.Errorf("Invalid Args")
+	}
+
+	hashedKey, err := c.hash.Process(accessKey)
+	if err != nil {
+		return 0, err
+	}
+
+	defer c.lockQueues(true, queueName)()
+
+	queue, found := c.db.Queues[queueName]
+	if !found {
+		return 0, fmt.Errorf("Not Found")
+	} else if queue.AccessKey != hashedKey {
+		return 0, fmt.Errorf("Unauthorized")
+	}
+
+	deadLetterQueue, found := c.db.Queues[queue.DeadLetterQueue]
+	if !found {
+		return 0, fmt.Errorf("No Dead Letter Queue")
+	}
+
+	requested := make(map[string]bool, len(uids))
+	for _, uid := range uids {
+		requested[uid] = true
+	}
+
+	redrive := make([]*Job, 0)
+	reserved := make(map[string]bool)
+	matched := 0
+	for _, job := range deadLetterQueue.ordered() {
+		if job.State != DeadLettered || job.SourceQueue != queueName || (len(uids) > 0 && !requested[job.UID]) {
+			continue
+		}
+
+		matched++
+		if queue.uniqueFree(job, reserved) {
+			redrive = append(redrive, job)
+		}
+	}
+
+	if len(uids) > 0 && matched != len(requested) {
+		return 0, fmt.Errorf("Not Found")
+	} else if len(uids) > 0 && len(redrive) != matched {
+		return 0, fmt.Errorf("Job Exists")
+	}
+
+	currentTime := time.Now().Unix()
+	for _, job := range redrive {
+		c.removeJob(deadLetterQueue, job)
+
+		job.State = Queued
+		job.Attempts = 0
+		job.NotBefore = 0
+		job.SourceQueue = ""
+		job.FailureReason = ""
+		job.LastUpdated = currentTime
+		queue.appendJob(job)
+		queue.indexUnique(job)
+		c.db.record(newJobEntry(queueName, job))
+	}
+
+	return len(redrive), nil
+}
+
+// deadLetterJob moves the given failed job to the queues dead-letter queue with the reason it failed, the job is left
+// as 'failed' if the queue has no dead-letter queue - must handle Lock outside of this function
+func (c *QueryControl) deadLetterJob(queue *Queue, job *Job, reason string, currentTime int64) {
+	deadLetterQueue, found := c.db.Queues[queue.DeadLetterQueue]
+	if !found {
+		return
+	}
+
+	c.removeJob(queue, job)
+
+	job.State = DeadLettered
+	job.SourceQueue = queue.Name
+	job.FailureReason = reason
+	job.LastUpdated = currentTime
+	deadLetterQueue.appendJob(job)
+	c.db.record(newJobEntry(deadLetterQueue.Name, job))
+	c.logger().Warn("Job Dead-Lettered",
+		logger.F("queue", queue.Name),
+		logger.F("uid", job.UID),
+		logger.F("dead_letter_queue", deadLetterQueue.Name),
+		logger.F("reason", reason),
+	)
+}
+
+// removeJob removes the given job from the queue, returns false if it was not found - must handle Lock outside of this
+// function
+func (c *QueryControl) removeJob(queue *Queue, job *Job) bool {
+	if !queue.removeJob(job) {
+		return false
+	}
+
+	queue.unindexUnique(job)
+	c.db.record(&WALEntry{Op: WALDeleteJob, QueueName: queue.Name, UID: job.UID})
+	return true
+}
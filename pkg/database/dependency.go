@@ -0,0 +1,188 @@
+package database
+
+import "github.com/MichaelWittgreffe/jobengine/pkg/logger"
+
+// ParentFailureFail marks a blocked job as 'failed' as soon as one of its parents fails, the default policy
+const ParentFailureFail string = "fail"
+
+// ParentFailureRun releases a blocked job once all of its parents have finished, whether they failed or not
+const ParentFailureRun string = "run"
+
+// ParentFailureWait keeps a blocked job blocked if one of its parents fails, until it is updated or deleted by the user
+const ParentFailureWait string = "wait"
+
+// JobDependency represents a parent job that must complete before the dependent job is released, the state is set once
+// the parent has finished as either 'complete' or 'failed'
+type JobDependency struct {
+	QueueName string `json:"queue_name"`
+	UID       string `json:"uid"`
+	State     string `json:"state,omitempty"`
+}
+
+// waiting returns whether the given blocked job is still waiting on the outcome of this parent, jobs using the wait policy
+// keep waiting on a failed parent in case it is redriven and completes
+func (d *JobDependency) waiting(job *Job) bool {
+	return len(d.State) == 0 || (d.State == Failed && job.OnParentFailure == ParentFailureWait)
+}
+
+// dependentRef locates a blocked job waiting on a parent
+type dependentRef struct {
+	queueName string
+	uid       string
+}
+
+// validParentFailure returns whether the given parent failure policy is supported, empty uses the default
+func validParentFailure(policy string) bool {
+	switch {
+	case len(policy) == 0, policy == ParentFailureFail, policy == ParentFailureRun, policy == ParentFailureWait:
+		return true
+	default:
+		return false
+	}
+}
+
+// findJob returns the job with the given UID in the given queue, nil if it cannot be found - must handle Lock outside of
+// this function
+func (c *QueryControl) findJob(queueName, uid string) *Job {
+	queue, found := c.db.Queues[queueName]
+	if !found {
+		return nil
+	}
+	return queue.lookup(uid)
+}
+
+// validateDependencies checks the parents of the given job exist, either in the database or within the pending UIDs
+// about to be added alongside it - must handle Lock outside of this function
+func (c *QueryControl) validateDependencies(job *Job, pending map[string]bool) bool {
+	for _, dependency := range job.DependsOn {
+		if dependency == nil || len(dependency.UID) == 0 || len(dependency.QueueName) == 0 {
+			return false
+		} else if !pending[dependency.UID] && c.findJob(dependency.QueueName, dependency.UID) == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// insertJob adds the given job to the queue, a job with dependencies is 'blocked' until its parents finish - must handle
+// Lock outside of this function
+func (c *QueryControl) insertJob(queue *Queue, job *Job, currentTime int64) {
+	for _, dependency := range job.DependsOn {
+		dependency.State = ""
+		if parent := c.findJob(dependency.QueueName, dependency.UID); parent == nil {
+			dependency.State = Failed
+		} else if parent.State == Complete {
+			dependency.State = Complete
+		} else if parent.State == Failed || parent.State == DeadLettered {
+			dependency.State = Failed
+		}
+	}
+
+	if len(job.DependsOn) > 0 {
+		job.State = Blocked
+	}
+
+	queue.appendJob(job)
+	queue.indexUnique(job)
+	c.db.record(newJobEntry(queue.Name, job))
+
+	if job.State == Blocked {
+		c.db.shared.Lock()
+		for _, dependency := range job.DependsOn {
+			if dependency.waiting(job) {
+				c.db.dependents[dependency.UID] = append(c.db.dependents[dependency.UID], &dependentRef{queueName: queue.Name, uid: job.UID})
+			}
+		}
+		c.db.shared.Unlock()
+		c.evaluateBlocked(queue, job, currentTime)
+	}
+}
+
+// resolveDependents records the outcome of a finished parent to be resolved against the jobs blocked on it, releasing or
+// failing them according to their policy once the locks held are released. Deleted jobs that had not finished are
+// resolved as 'failed' - must handle Lock outside of this function
+func (c *QueryControl) resolveDependents(uid, outcome string, currentTime int64) {
+	c.db.shared.Lock()
+	defer c.db.shared.Unlock()
+
+	if _, found := c.db.dependents[uid]; found {
+		c.db.resolutions = append(c.db.resolutions, &resolution{uid: uid, outcome: outcome, currentTime: currentTime})
+	}
+}
+
+// resolveDependent records the outcome of a finished parent against a job blocked on it, the job keeps waiting on the
+// parent if it failed and the job uses the wait policy - must handle Lock of the queue of the job outside of this function
+func (c *QueryControl) resolveDependent(ref *dependentRef, parent *resolution) {
+	queue, found := c.db.Queues[ref.queueName]
+	if !found {
+		return
+	}
+
+	child := c.findJob(ref.queueName, ref.uid)
+	if child == nil || child.State != Blocked {
+		return
+	}
+
+	for _, dependency := range child.DependsOn {
+		if dependency.UID == parent.uid {
+			dependency.State = parent.outcome
+		}
+	}
+	c.evaluateBlocked(queue, child, parent.currentTime)
+	if child.State == Blocked {
+		// the outcome of the parent must be saved even though the job is still waiting on others, otherwise once loaded it
+		// waits on a parent that will never finish again
+		c.db.record(newJobEntry(queue.Name, child))
+	}
+
+	if child.State == Blocked && parent.outcome == Failed && child.OnParentFailure == ParentFailureWait {
+		c.db.shared.Lock()
+		c.db.dependents[parent.uid] = append(c.db.dependents[parent.uid], ref)
+		c.db.shared.Unlock()
+	}
+}
+
+// evaluateBlocked releases the given blocked job to 'queued' once its parents have completed, or fails it if a parent
+// failed under the default policy - must handle Lock outside of this function
+func (c *QueryControl) evaluateBlocked(queue *Queue, job *Job, currentTime int64) {
+	pending, failed := false, false
+	for _, dependency := range job.DependsOn {
+		if dependency.State == Failed {
+			failed = true
+		} else if dependency.State != Complete {
+			pending = true
+		}
+	}
+
+	switch {
+	case failed && (len(job.OnParentFailure) == 0 || job.OnParentFailure == ParentFailureFail):
+		job.State = Failed
+		job.FailureReason = "Parent Failed"
+		job.LastUpdated = currentTime
+		c.db.record(newJobEntry(queue.Name, job))
+		c.logger().Warn("Job Parent Failed", logger.F("queue", queue.Name), logger.F("uid", job.UID))
+		c.resolveDependents(job.UID, Failed, currentTime)
+	case pending, failed && job.OnParentFailure == ParentFailureWait:
+		return
+	default:
+		job.State = Queued
+		job.LastUpdated = currentTime
+		c.db.record(newJobEntry(queue.Name, job))
+		c.logger().Debug("Job Unblocked", logger.F("queue", queue.Name), logger.F("uid", job.UID))
+	}
+}
+
+// moveDependent updates where a blocked job is found once it is moved to another queue - must handle Lock outside of this
+// function
+func (db *DBFile) moveDependent(job *Job, from, to string) {
+	db.shared.Lock()
+	defer db.shared.Unlock()
+
+	for _, dependency := range job.DependsOn {
+		for _, ref := range db.dependents[dependency.UID] {
+			if ref.uid == job.UID && ref.queueName == from {
+				ref.queueName = to
+			}
+		}
+	}
+}
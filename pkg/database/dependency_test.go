@@ -0,0 +1,104 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/MichaelWittgreffe/jobengine/pkg/crypto"
+	"github.com/MichaelWittgreffe/jobengine/pkg/logger"
+)
+
+// addDiamond adds jobs 'b' and 'c' and a job 'd' blocked on both of them to the queue
+func addDiamond(t *testing.T, controller QueryController) {
+	t.Helper()
+	jobs := []*Job{
+		{UID: "b", State: Queued},
+		{UID: "c", State: Queued},
+		{UID: "d", State: Queued, DependsOn: []*JobDependency{{QueueName: "queue", UID: "b"}, {QueueName: "queue", UID: "c"}}},
+	}
+	for _, job := range jobs {
+		if _, _, err := controller.AddJob(job, "queue", testKey); err != nil {
+			t.Fatalf("AddJob(%s): %s", job.UID, err)
+		}
+	}
+}
+
+// reload saves the database with the handler and loads it again, returning a controller over the loaded database
+func reload(t *testing.T, db *DBFile, handlerType, path string) *QueryControl {
+	t.Helper()
+	if err := newTestFileHandler(t, handlerType, nil).SaveToFile(db, path); err != nil {
+		t.Fatalf("SaveToFile: %s", err)
+	}
+
+	loaded := NewDBFile()
+	if err := newTestFileHandler(t, handlerType, nil).LoadFromFile(loaded, path); err != nil {
+		t.Fatalf("LoadFromFile: %s", err)
+	}
+	return NewQueryController(loaded, crypto.NewHashHandler("sha512"), logger.NewLogger("text", "error")).(*QueryControl)
+}
+
+// checkState fails the test unless the job in the queue has the given state
+func checkState(t *testing.T, controller *QueryControl, uid, state string) {
+	t.Helper()
+	job, err := controller.GetJob(uid, "queue", testKey)
+	if err != nil {
+		t.Fatalf("GetJob(%s): %s", uid, err)
+	} else if job.State != state {
+		t.Errorf("job %s is %s, want %s", uid, job.State, state)
+	}
+}
+
+func TestDependencyDiamondRestart(t *testing.T) {
+	for _, handlerType := range []string{"fs", "wal"} {
+		t.Run(handlerType, func(t *testing.T) {
+			path := newTestPath(t)
+			db, controller := newTestController(t, "queue")
+			addDiamond(t, controller)
+			if err := newTestFileHandler(t, handlerType, nil).SaveToFile(db, path); err != nil {
+				t.Fatalf("SaveToFile: %s", err)
+			}
+
+			setStatus(t, controller, "queue", "b", Complete)
+			controller = reload(t, db, handlerType, path)
+			checkState(t, controller, "d", Blocked)
+
+			setStatus(t, controller, "queue", "c", Complete)
+			checkState(t, controller, "d", Queued)
+		})
+	}
+}
+
+func TestDependencyParentFinishedBeforeLoad(t *testing.T) {
+	db, controller := newTestController(t, "queue")
+	addDiamond(t, controller)
+
+	// the parents are saved as finished without their outcome being resolved against the blocked job
+	db.Queues["queue"].lookup("b").State = Complete
+	db.Queues["queue"].lookup("c").State = Complete
+	controller = reload(t, db, "fs", newTestPath(t))
+
+	// the outcomes are resolved once the queues are next locked
+	if err := controller.UpdateQueue("queue"); err != nil {
+		t.Fatalf("UpdateQueue: %s", err)
+	}
+	checkState(t, controller, "d", Queued)
+}
+
+func TestUpdateJobStatusBlocked(t *testing.T) {
+	_, controller := newTestController(t, "queue")
+	addDiamond(t, controller)
+
+	for _, status := range []string{Queued, Inprogress, Complete} {
+		if err := controller.UpdateJobStatus("d", status, "", "", "queue", testKey); err == nil || err.Error() != "Job Blocked" {
+			t.Errorf("UpdateJobStatus(%s) of a blocked job: %v, want Job Blocked", status, err)
+		}
+	}
+	checkState(t, controller, "d", Blocked)
+
+	setStatus(t, controller, "queue", "d", Failed)
+	checkState(t, controller, "d", Failed)
+
+	// the parents finishing no longer release the cancelled job
+	setStatus(t, controller, "queue", "b", Complete)
+	setStatus(t, controller, "queue", "c", Complete)
+	checkState(t, controller, "d", Failed)
+}
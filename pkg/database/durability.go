@@ -0,0 +1,58 @@
+package database
+
+// DurabilityMemory keeps the jobs of a queue in memory only, they are lost when the application restarts. The queue and
+// its schedules are still saved
+const DurabilityMemory string = "memory"
+
+// DurabilityAsync saves changes to a queue in the background after they are acknowledged, the default
+const DurabilityAsync string = "async"
+
+// DurabilitySync acknowledges changes to a queue only once they are saved
+const DurabilitySync string = "sync"
+
+// validDurability returns whether the given durability mode is supported, empty is the default
+func validDurability(durability string) bool {
+	return len(durability) == 0 || durability == DurabilityMemory || durability == DurabilityAsync || durability == DurabilitySync
+}
+
+// Durability returns the durability mode of the given queue, DurabilityAsync if it is not set or the queue does not exist
+func (c *QueryControl) Durability(queueName string) string {
+	c.readLockDB()
+	defer c.db.lock.RUnlock()
+
+	if queue, found := c.db.Queues[queueName]; found && len(queue.Durability) > 0 {
+		return queue.Durability
+	}
+	return DurabilityAsync
+}
+
+// persisted returns whether the given mutation is saved, changes to the jobs of in-memory queues are not - must handle
+// Lock outside of this function
+func (db *DBFile) persisted(entry *WALEntry) bool {
+	switch {
+	case entry.Op == WALPutJob || entry.Op == WALDeleteJob || entry.Op == WALPutIdempotencyKey:
+		if queue, found := db.Queues[entry.QueueName]; found && queue.Durability == DurabilityMemory {
+			return false
+		}
+	}
+	return true
+}
+
+// persistent returns a copy of the DBFile holding only what is saved, the queues of in-memory queues are copied without
+// their jobs. Jobs are saved in the order they were added, so the order of jobs with the same priority is kept once
+// loaded - must handle Lock outside of this function
+func (db *DBFile) persistent() *DBFile {
+	result := &DBFile{Queues: make(map[string]*Queue, len(db.Queues))}
+	for name, queue := range db.Queues {
+		saved := *queue
+		if queue.Durability != DurabilityMemory {
+			saved.Jobs = queue.sequenced()
+		} else {
+			saved.Jobs = make([]*Job, 0)
+			saved.Size = 0
+			saved.IdempotencyKeys = nil
+		}
+		result.Queues[name] = &saved
+	}
+	return result
+}
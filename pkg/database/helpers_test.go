@@ -0,0 +1,68 @@
+package database
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MichaelWittgreffe/jobengine/pkg/crypto"
+	"github.com/MichaelWittgreffe/jobengine/pkg/filesystem"
+	"github.com/MichaelWittgreffe/jobengine/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// testKey is the access key of the queues created by the tests
+const testKey string = "test-key"
+
+// newTestController returns a controller over a new database holding the given queues, each with testKey
+func newTestController(t testing.TB, queueNames ...string) (*DBFile, *QueryControl) {
+	t.Helper()
+	db := NewDBFile()
+	controller := NewQueryController(db, crypto.NewHashHandler("sha512"), logger.NewLogger("text", "error")).(*QueryControl)
+	for _, name := range queueNames {
+		if err := controller.CreateQueue(name, testKey, nil); err != nil {
+			t.Fatalf("CreateQueue(%s): %s", name, err)
+		}
+	}
+	return db, controller
+}
+
+// newTestFileHandler returns a DBFileHandler of the given type using fileSystem, the os file system if nil
+func newTestFileHandler(t testing.TB, handlerType string, fileSystem filesystem.FileSystem) DBFileHandler {
+	t.Helper()
+	if fileSystem == nil {
+		fileSystem = filesystem.NewFileSystem("os")
+	}
+	encrypt := crypto.NewEncryptionHandler("0123456789abcdef0123456789abcdef", "AES", crypto.NewHashHandler("md5"))
+	handler := NewDBFileHandler(handlerType, encrypt, NewDBDataHandler("json"), fileSystem)
+	if handler == nil {
+		t.Fatalf("NewDBFileHandler(%s) returned nil", handlerType)
+	}
+	return handler
+}
+
+// newTestPath returns the path of a database file in a new temporary directory, removed once the test finishes
+func newTestPath(t testing.TB) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "jobengine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "jobengine.db")
+}
+
+// addTestJobs adds count queued jobs with the given priority to the queue, returning their UIDs in the order added
+func addTestJobs(t testing.TB, controller QueryController, queueName string, count, priority int) []string {
+	t.Helper()
+	uids := make([]string, count)
+	for i := range uids {
+		job := &Job{UID: uuid.New().String(), State: Queued, Priority: priority}
+		if _, _, err := controller.AddJob(job, queueName, testKey); err != nil {
+			t.Fatalf("AddJob: %s", err)
+		}
+		uids[i] = job.UID
+	}
+	return uids
+}
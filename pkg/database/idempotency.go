@@ -0,0 +1,84 @@
+package database
+
+import "sort"
+
+// defaultIdempotencyWindowSeconds is how long an idempotency key is remembered for if the queue does not set a window
+const defaultIdempotencyWindowSeconds int64 = 86400
+
+// IdempotencyKey records the job created with a client supplied key, a repeated submission with the same key before it
+// expires returns the original job rather than adding a new one
+type IdempotencyKey struct {
+	UID     string `json:"uid"`
+	Expires int64  `json:"expires"`
+}
+
+// idempotencyRef holds a key in the order it expires, the record is compared so a key that has been reused is not removed
+type idempotencyRef struct {
+	key    string
+	record *IdempotencyKey
+}
+
+// idempotencyWindow returns the number of seconds keys are remembered for by the queue
+func (q *Queue) idempotencyWindow() int64 {
+	if q.IdempotencyWindowSeconds > 0 {
+		return q.IdempotencyWindowSeconds
+	}
+	return defaultIdempotencyWindowSeconds
+}
+
+// putIdempotencyKey records the given key against the job UID in the queue
+func (q *Queue) putIdempotencyKey(key string, record *IdempotencyKey) {
+	if q.IdempotencyKeys == nil {
+		q.IdempotencyKeys = make(map[string]*IdempotencyKey)
+	}
+	q.IdempotencyKeys[key] = record
+	q.keyOrder = append(q.keyOrder, &idempotencyRef{key: key, record: record})
+}
+
+// buildKeyOrder rebuilds the expiry order of the queues idempotency keys once loaded
+func (q *Queue) buildKeyOrder() {
+	q.keyOrder = make([]*idempotencyRef, 0, len(q.IdempotencyKeys))
+	for key, record := range q.IdempotencyKeys {
+		q.keyOrder = append(q.keyOrder, &idempotencyRef{key: key, record: record})
+	}
+	sort.Slice(q.keyOrder, func(i, j int) bool {
+		return q.keyOrder[i].record.Expires < q.keyOrder[j].record.Expires
+	})
+}
+
+// pruneIdempotencyKeys forgets the keys in the queue that have expired. Removals are not logged, an expired key replayed
+// from the log is removed again on the next update
+func (q *Queue) pruneIdempotencyKeys(currentTime int64) {
+	expired := 0
+	for _, ref := range q.keyOrder {
+		if ref.record.Expires >= currentTime {
+			break
+		}
+		if q.IdempotencyKeys[ref.key] == ref.record {
+			delete(q.IdempotencyKeys, ref.key)
+		}
+		expired++
+	}
+
+	if expired > 0 {
+		copy(q.keyOrder, q.keyOrder[expired:])
+		for i := len(q.keyOrder) - expired; i < len(q.keyOrder); i++ {
+			q.keyOrder[i] = nil
+		}
+		q.keyOrder = q.keyOrder[:len(q.keyOrder)-expired]
+	}
+}
+
+// findIdempotentJob returns a copy of the job previously created with the given key, nil if the key is not held. If the
+// original job has since been removed from the queue only its UID is returned - must handle Lock outside of this function
+func (c *QueryControl) findIdempotentJob(queue *Queue, key string, currentTime int64) *Job {
+	record, found := queue.IdempotencyKeys[key]
+	if !found || record.Expires < currentTime {
+		return nil
+	}
+
+	if job := queue.lookup(record.UID); job != nil {
+		return job.copy()
+	}
+	return &Job{UID: record.UID, IdempotencyKey: key}
+}
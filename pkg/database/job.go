@@ -2,13 +2,75 @@ package database
 
 // Job represents a job within the database
 type Job struct {
-	Priority       int                    `json:"priority"`
-	KeepMinutes    int64                  `json:"keep_minutes"`
-	TimeoutMinutes int64                  `json:"timeout_minutes"`
-	LastUpdated    int64                  `json:"last_updated"`
-	Created        int64                  `json:"created"`
-	TimeoutTime    int64                  `json:"timeout_time"`
-	UID            string                 `json:"uid"`
-	Content        map[string]interface{} `json:"content"`
-	State          string                 `json:"state"`
+	Priority        int                    `json:"priority"`
+	KeepMinutes     int64                  `json:"keep_minutes"`
+	TimeoutMinutes  int64                  `json:"timeout_minutes"`
+	LastUpdated     int64                  `json:"last_updated"`
+	Created         int64                  `json:"created"`
+	TimeoutTime     int64                  `json:"timeout_time"`
+	RunAt           int64                  `json:"run_at"`
+	UID             string                 `json:"uid"`
+	Content         map[string]interface{} `json:"content"`
+	State           string                 `json:"state"`
+	LeaseKey        string                 `json:"lease_key,omitempty"`
+	LeaseExpires    int64                  `json:"lease_expires,omitempty"`
+	MaxAttempts     int                    `json:"max_attempts"`
+	Attempts        int                    `json:"attempts"`
+	Backoff         *BackoffPolicy         `json:"backoff,omitempty"`
+	NotBefore       int64                  `json:"not_before"`
+	RetryHistory    []*RetryRecord         `json:"retry_history,omitempty"`
+	SourceQueue     string                 `json:"source_queue,omitempty"`
+	FailureReason   string                 `json:"failure_reason,omitempty"`
+	ScheduleName    string                 `json:"schedule,omitempty"`
+	DependsOn       []*JobDependency       `json:"depends_on,omitempty"`
+	OnParentFailure string                 `json:"on_parent_failure,omitempty"`
+	WorkflowID      string                 `json:"workflow_id,omitempty"`
+	IdempotencyKey  string                 `json:"idempotency_key,omitempty"`
+	TraceParent     string                 `json:"trace_parent,omitempty"`
+	TraceState      string                 `json:"trace_state,omitempty"`
+}
+
+// validJob returns whether the options given on a new job are valid
+func validJob(job *Job) bool {
+	return job.MaxAttempts >= 0 && job.RunAt >= 0 && (job.Backoff == nil || job.Backoff.Valid()) && validParentFailure(job.OnParentFailure)
+}
+
+// Available returns whether the job is 'queued' and neither scheduled for later or waiting before a retry at the given
+// unix time
+func (j *Job) Available(currentTime int64) bool {
+	return j.State == Queued && j.AvailableFrom() <= currentTime
+}
+
+// AvailableFrom returns the unix time from which the job can be processed if it is 'queued'
+func (j *Job) AvailableFrom() int64 {
+	if j.NotBefore > j.RunAt {
+		return j.NotBefore
+	}
+	return j.RunAt
+}
+
+// copy returns a copy of the job that can be read once the lock of its queue is released, the parents it depends on are
+// copied too as their state is set when they finish
+func (j *Job) copy() *Job {
+	result := *j
+	if j.RetryHistory != nil {
+		result.RetryHistory = append(make([]*RetryRecord, 0, len(j.RetryHistory)), j.RetryHistory...)
+	}
+	if j.DependsOn != nil {
+		result.DependsOn = make([]*JobDependency, len(j.DependsOn))
+		for i, dependency := range j.DependsOn {
+			state := *dependency
+			result.DependsOn[i] = &state
+		}
+	}
+	return &result
+}
+
+// copyJobs returns copies of the given jobs, as for copy
+func copyJobs(jobs []*Job) []*Job {
+	result := make([]*Job, len(jobs))
+	for i, job := range jobs {
+		result[i] = job.copy()
+	}
+	return result
 }
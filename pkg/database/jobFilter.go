@@ -0,0 +1,64 @@
+package database
+
+import "reflect"
+
+// JobFilter selects jobs within a queue, every field set must match. Content holds paths into the job content separated
+// by '.' mapped to the value the field must equal
+type JobFilter struct {
+	States        []string               `json:"states,omitempty"`
+	CreatedAfter  int64                  `json:"created_after,omitempty"`
+	CreatedBefore int64                  `json:"created_before,omitempty"`
+	UpdatedAfter  int64                  `json:"updated_after,omitempty"`
+	UpdatedBefore int64                  `json:"updated_before,omitempty"`
+	MinPriority   *int                   `json:"min_priority,omitempty"`
+	MaxPriority   *int                   `json:"max_priority,omitempty"`
+	Content       map[string]interface{} `json:"content,omitempty"`
+}
+
+// Valid returns whether the filter only uses known states and content paths
+func (f *JobFilter) Valid() bool {
+	for _, state := range f.States {
+		switch state {
+		case Queued, Inprogress, Complete, Failed, Blocked, DeadLettered:
+		default:
+			return false
+		}
+	}
+
+	for path := range f.Content {
+		if !validFieldPath(path) {
+			return false
+		}
+	}
+	return true
+}
+
+// Match returns whether the given job is selected by the filter, times are inclusive
+func (f *JobFilter) Match(job *Job) bool {
+	if len(f.States) > 0 {
+		found := false
+		for _, state := range f.States {
+			found = found || job.State == state
+		}
+		if !found {
+			return false
+		}
+	}
+
+	switch {
+	case f.CreatedAfter > 0 && job.Created < f.CreatedAfter,
+		f.CreatedBefore > 0 && job.Created > f.CreatedBefore,
+		f.UpdatedAfter > 0 && job.LastUpdated < f.UpdatedAfter,
+		f.UpdatedBefore > 0 && job.LastUpdated > f.UpdatedBefore,
+		f.MinPriority != nil && job.Priority < *f.MinPriority,
+		f.MaxPriority != nil && job.Priority > *f.MaxPriority:
+		return false
+	}
+
+	for path, expected := range f.Content {
+		if value, found := lookupField(job.Content, path); !found || !reflect.DeepEqual(value, expected) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,344 @@
+package database
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// queuedHeap is the heap kind holding 'queued' jobs in the order they are processed in
+const queuedHeap int = 0
+
+// expiryHeap is the heap kind holding jobs by the time they are next due to be updated by UpdateQueue
+const expiryHeap int = 1
+
+// jobIndex locates the jobs of a queue by UID and keeps them in heaps by state, so neither finding a job nor the next job
+// to process needs every job of the queue checking. Queued jobs are held in one of two heaps, those that can be processed
+// now by priority then the time they became avalible, and those not yet avalible by the time they become avalible. Jobs
+// with the same priority and time are ordered by when they were added to the queue, so they are processed first in,
+// first out. Jobs that time out or leave the keep window are also held by when that happens
+type jobIndex struct {
+	jobs     map[string]*indexedJob
+	ready    *jobHeap
+	delayed  *jobHeap
+	expiring *jobHeap
+	sequence int64
+	checked  int64
+}
+
+// indexedJob holds a job of the queue with where it is held. The fields it is ordered by are copied from the job as it
+// was last indexed, so a job changed before it is indexed again cannot break the heaps it is in
+type indexedJob struct {
+	job       *Job
+	slot      int
+	sequence  int64
+	priority  int
+	from      int64
+	expires   bool
+	deadline  int64
+	heaps     [2]*jobHeap
+	positions [2]int
+}
+
+// jobHeap is a heap of indexed jobs in the order given by less, implementing heap.Interface. Each job can be held in one
+// heap of each kind
+type jobHeap struct {
+	items []*indexedJob
+	less  func(a, b *indexedJob) bool
+	kind  int
+}
+
+// newJobIndex is a constructor for jobIndex
+func newJobIndex() *jobIndex {
+	return &jobIndex{
+		jobs:     make(map[string]*indexedJob),
+		ready:    &jobHeap{items: make([]*indexedJob, 0), less: byPriority, kind: queuedHeap},
+		delayed:  &jobHeap{items: make([]*indexedJob, 0), less: byAvailable, kind: queuedHeap},
+		expiring: &jobHeap{items: make([]*indexedJob, 0), less: byDeadline, kind: expiryHeap},
+	}
+}
+
+// byPriority orders jobs by priority (100 at head, 0 at tail), then the time they become avalible, then the order they
+// were added to the queue
+func byPriority(a, b *indexedJob) bool {
+	if a.priority != b.priority {
+		return a.priority > b.priority
+	} else if a.from != b.from {
+		return a.from < b.from
+	}
+	return a.sequence < b.sequence
+}
+
+// byAvailable orders jobs by the time they become avalible, then the order they were added to the queue
+func byAvailable(a, b *indexedJob) bool {
+	if a.from != b.from {
+		return a.from < b.from
+	}
+	return a.sequence < b.sequence
+}
+
+// byDeadline orders jobs by the time they are next due to be updated, then the order they were added to the queue
+func byDeadline(a, b *indexedJob) bool {
+	if a.deadline != b.deadline {
+		return a.deadline < b.deadline
+	}
+	return a.sequence < b.sequence
+}
+
+// bySequence orders jobs by the order they were added to the queue
+func bySequence(a, b *indexedJob) bool {
+	return a.sequence < b.sequence
+}
+
+// jobDeadline returns the unix time after which UpdateQueue next changes the given job, false if it is left as it is.
+// Complete and failed jobs are removed once outside their keep window, inprogress jobs fail once their lease expires or
+// they time out, and queued jobs are removed once they time out
+func jobDeadline(job *Job) (int64, bool) {
+	switch {
+	case job.State == Complete || job.State == Failed:
+		return job.LastUpdated + (job.KeepMinutes * 60), true
+	case job.State == Inprogress && job.LeaseExpires > 0:
+		return job.LeaseExpires, true
+	case job.State == Inprogress:
+		return job.LastUpdated + (job.TimeoutMinutes * 60), true
+	case job.State == Queued && job.TimeoutTime > 0:
+		return job.TimeoutTime, true
+	default:
+		return 0, false
+	}
+}
+
+// Len returns the number of jobs in the heap
+func (h *jobHeap) Len() int {
+	return len(h.items)
+}
+
+// Less returns whether the job at i comes before the job at j
+func (h *jobHeap) Less(i, j int) bool {
+	return h.less(h.items[i], h.items[j])
+}
+
+// Swap swaps the jobs at i and j, keeping the position each job is held at
+func (h *jobHeap) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	h.items[i].positions[h.kind] = i
+	h.items[j].positions[h.kind] = j
+}
+
+// Push adds the given indexed job to the end of the heap, use heap.Push to keep it ordered
+func (h *jobHeap) Push(x interface{}) {
+	item := x.(*indexedJob)
+	item.heaps[h.kind] = h
+	item.positions[h.kind] = len(h.items)
+	h.items = append(h.items, item)
+}
+
+// Pop removes the job at the end of the heap, use heap.Pop to remove the head
+func (h *jobHeap) Pop() interface{} {
+	last := len(h.items) - 1
+	item := h.items[last]
+	h.items[last] = nil
+	h.items = h.items[:last]
+	item.heaps[h.kind] = nil
+	item.positions[h.kind] = -1
+	return item
+}
+
+// head returns the first job of the heap, nil if it is empty
+func (h *jobHeap) head() *indexedJob {
+	if len(h.items) == 0 {
+		return nil
+	}
+	return h.items[0]
+}
+
+// index returns the index of the queue, created if the queue does not have one yet
+func (q *Queue) index() *jobIndex {
+	if q.indexed == nil {
+		q.indexed = newJobIndex()
+	}
+	return q.indexed
+}
+
+// buildIndex indexes the jobs held by the queue once it is loaded, jobs are taken to have been added in the order they
+// are held
+func (q *Queue) buildIndex() {
+	q.indexed = newJobIndex()
+	for slot, job := range q.Jobs {
+		q.indexed.add(job, slot)
+	}
+	q.Size = len(q.Jobs)
+}
+
+// lookup returns the job with the given UID, nil if the queue does not hold it - must handle Lock outside of this
+// function
+func (q *Queue) lookup(uid string) *Job {
+	if item, found := q.index().jobs[uid]; found {
+		return item.job
+	}
+	return nil
+}
+
+// appendJob adds the given job to the end of the queue - must handle Lock outside of this function
+func (q *Queue) appendJob(job *Job) {
+	q.index().add(job, len(q.Jobs))
+	q.Jobs = append(q.Jobs, job)
+	q.Size = len(q.Jobs)
+}
+
+// removeJob removes the given job from the queue by moving the last job into its place, as the order jobs are processed
+// in is kept by the index. Returns false if the queue does not hold the job - must handle Lock outside of this function
+func (q *Queue) removeJob(job *Job) bool {
+	index := q.index()
+	item, found := index.jobs[job.UID]
+	if !found {
+		return false
+	}
+
+	last := len(q.Jobs) - 1
+	if item.slot != last {
+		moved := q.Jobs[last]
+		q.Jobs[item.slot] = moved
+		index.jobs[moved.UID].slot = item.slot
+	}
+	q.Jobs[last] = nil
+	q.Jobs = q.Jobs[:last]
+	q.Size = len(q.Jobs)
+
+	index.unplace(item)
+	delete(index.jobs, job.UID)
+	return true
+}
+
+// nextJob returns the first job avalible for processing at the given unix time, nil if none are - must handle Lock
+// outside of this function
+func (q *Queue) nextJob(currentTime int64) *Job {
+	index := q.index()
+	for item := index.delayed.head(); item != nil && item.from <= currentTime; item = index.delayed.head() {
+		heap.Push(index.ready, heap.Pop(index.delayed))
+	}
+	if currentTime > index.checked {
+		index.checked = currentTime
+	}
+
+	if item := index.ready.head(); item != nil {
+		return item.job
+	}
+	return nil
+}
+
+// expiredJobs returns the jobs due to be updated by UpdateQueue before the given unix time, in the order they were added
+// to the queue - must handle Lock outside of this function
+func (q *Queue) expiredJobs(currentTime int64) []*Job {
+	items := q.index().expiring.items
+	expired := make([]*indexedJob, 0)
+
+	// the heap is walked from its head, the jobs below one that is not due are not due either
+	pending := []int{0}
+	for len(pending) > 0 {
+		position := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if position >= len(items) || items[position].deadline >= currentTime {
+			continue
+		}
+		expired = append(expired, items[position])
+		pending = append(pending, (2*position)+1, (2*position)+2)
+	}
+
+	sort.Slice(expired, func(i, j int) bool {
+		return bySequence(expired[i], expired[j])
+	})
+
+	result := make([]*Job, len(expired))
+	for i, item := range expired {
+		result[i] = item.job
+	}
+	return result
+}
+
+// ordered returns the jobs of the queue in the order they are processed in, the order jobs not 'queued' would be
+// processed in if they were - must handle Lock outside of this function
+func (q *Queue) ordered() []*Job {
+	return q.sortedJobs(byPriority)
+}
+
+// sequenced returns the jobs of the queue in the order they were added to it, the order they are saved in so it is kept
+// once loaded - must handle Lock outside of this function
+func (q *Queue) sequenced() []*Job {
+	return q.sortedJobs(bySequence)
+}
+
+// sortedJobs returns the jobs of the queue in the given order - must handle Lock outside of this function
+func (q *Queue) sortedJobs(less func(a, b *indexedJob) bool) []*Job {
+	index := q.index()
+	items := make([]*indexedJob, 0, len(q.Jobs))
+	for _, job := range q.Jobs {
+		item := *index.jobs[job.UID]
+		item.priority = job.Priority
+		item.from = job.AvailableFrom()
+		items = append(items, &item)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return less(items[i], items[j])
+	})
+
+	result := make([]*Job, len(items))
+	for i, item := range items {
+		result[i] = item.job
+	}
+	return result
+}
+
+// add indexes the given job held at the given slot of the queue as the last added - must handle Lock outside of this
+// function
+func (i *jobIndex) add(job *Job, slot int) {
+	i.sequence++
+	item := &indexedJob{job: job, slot: slot, sequence: i.sequence, positions: [2]int{-1, -1}}
+	i.jobs[job.UID] = item
+	i.update(item, job)
+}
+
+// update moves the given indexed job to the heaps the given state of it belongs in. A 'queued' job that was not avalible
+// when the queue was last checked for avalible jobs is held as not yet avalible, until the queue is next checked - must
+// handle Lock outside of this function
+func (i *jobIndex) update(item *indexedJob, job *Job) {
+	i.unplace(item)
+
+	item.priority = job.Priority
+	item.from = job.AvailableFrom()
+	item.deadline, item.expires = jobDeadline(job)
+
+	if job.State == Queued && item.from <= i.checked {
+		heap.Push(i.ready, item)
+	} else if job.State == Queued {
+		heap.Push(i.delayed, item)
+	}
+	if item.expires {
+		heap.Push(i.expiring, item)
+	}
+}
+
+// unplace removes the given indexed job from the heaps it is held in - must handle Lock outside of this function
+func (i *jobIndex) unplace(item *indexedJob) {
+	for kind, held := range item.heaps {
+		if held != nil {
+			heap.Remove(held, item.positions[kind])
+		}
+	}
+}
+
+// trackOrder keeps the index of the queue the given entry changes in order - must handle Lock outside of this function
+func (db *DBFile) trackOrder(entry *WALEntry) {
+	if entry.Op != WALPutJob {
+		return
+	}
+
+	queue, found := db.Queues[entry.QueueName]
+	if !found {
+		return
+	}
+
+	if item, found := queue.index().jobs[entry.Job.UID]; found {
+		queue.index().update(item, entry.Job)
+	}
+}
@@ -0,0 +1,172 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// OperationRequeue returns matching jobs that have started or finished to 'queued' with their attempts reset. Blocked
+// jobs are left waiting on their dependencies, dead-lettered jobs are returned to their queue by redriving them. Jobs
+// matching the unique fields of an active job are not requeued
+const OperationRequeue string = "requeue"
+
+// OperationFail marks matching jobs that have not finished as 'failed' without further attempts, moving them to the
+// queues dead-letter queue if one is set
+const OperationFail string = "fail"
+
+// OperationDelete removes matching jobs from the queue
+const OperationDelete string = "delete"
+
+// OperationPriority sets the priority of matching jobs
+const OperationPriority string = "priority"
+
+// OperationMove moves matching jobs to another queue, keeping their state. Active jobs matching the unique fields of an
+// active job in the other queue are not moved
+const OperationMove string = "move"
+
+// JobOperation represents a change applied to every job in a queue matching the filter
+type JobOperation struct {
+	Op          string     `json:"operation"`
+	Filter      *JobFilter `json:"filter"`
+	Priority    int        `json:"priority,omitempty"`
+	TargetQueue string     `json:"target_queue,omitempty"`
+	Reason      string     `json:"reason,omitempty"`
+}
+
+// affects returns whether the operation would change the given job
+func (o *JobOperation) affects(job *Job) bool {
+	switch o.Op {
+	case OperationRequeue:
+		return job.State == Inprogress || job.State == Complete || job.State == Failed
+	case OperationFail:
+		return job.State == Queued || job.State == Inprogress || job.State == Blocked
+	case OperationPriority:
+		return job.Priority != o.Priority
+	default:
+		return true
+	}
+}
+
+// validOperation returns whether the given operation is supported
+func validOperation(op string) bool {
+	switch op {
+	case OperationRequeue, OperationFail, OperationDelete, OperationPriority, OperationMove:
+		return true
+	default:
+		return false
+	}
+}
+
+// ApplyJobOperation applies the operation to every job in the given queue matching its filter, returning the number of
+// jobs changed. Nothing is changed if dryRun is set, only the number of jobs that would be. A target queue to move jobs
+// to must use the same access key
+func (c *QueryControl) ApplyJobOperation(operation *JobOperation, queueName, accessKey string, dryRun bool) (int, error) {
+	if operation == nil || operation.Filter == nil || !operation.Filter.Valid() || !validOperation(operation.Op) || len(queueName) == 0 || len(accessKey) == 0 {
+		return 0, fmt.Errorf("Invalid Args")
+	} else if operation.Op == OperationMove && (len(operation.TargetQueue) == 0 || operation.TargetQueue == queueName) {
+		return 0, fmt.Errorf("Invalid Args")
+	}
+
+	hashedKey, err := c.hash.Process(accessKey)
+	if err != nil {
+		return 0, err
+	}
+
+	defer c.lockQueues(true, queueName, operation.TargetQueue)()
+
+	queue, found := c.db.Queues[queueName]
+	if !found {
+		return 0, fmt.Errorf("Not Found")
+	} else if queue.AccessKey != hashedKey {
+		return 0, fmt.Errorf("Unauthorized")
+	}
+
+	var target *Queue
+	if operation.Op == OperationMove {
+		if target, found = c.db.Queues[operation.TargetQueue]; !found {
+			return 0, fmt.Errorf("Not Found")
+		} else if target.AccessKey != hashedKey {
+			return 0, fmt.Errorf("Unauthorized")
+		}
+	}
+
+	jobs := make([]*Job, 0)
+	reserved := make(map[string]bool)
+	for _, job := range queue.ordered() {
+		if !operation.Filter.Match(job) || !operation.affects(job) {
+			continue
+		}
+
+		// a job that would be active alongside another with the same unique field values is left as it is
+		if operation.Op == OperationRequeue && !queue.uniqueFree(job, reserved) {
+			continue
+		} else if operation.Op == OperationMove && uniqueActive(job) && !target.uniqueFree(job, reserved) {
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+
+	if dryRun || len(jobs) == 0 {
+		return len(jobs), nil
+	}
+
+	currentTime := time.Now().Unix()
+	switch operation.Op {
+	case OperationRequeue:
+		for _, job := range jobs {
+			job.State = Queued
+			job.Attempts = 0
+			job.NotBefore = 0
+			job.LeaseKey = ""
+			job.LeaseExpires = 0
+			job.FailureReason = ""
+			job.LastUpdated = currentTime
+			queue.indexUnique(job)
+			c.db.record(newJobEntry(queueName, job))
+		}
+	case OperationFail:
+		for _, job := range jobs {
+			job.RetryHistory = append(job.RetryHistory, &RetryRecord{
+				Attempt: job.Attempts,
+				Failed:  currentTime,
+				Error:   operation.Reason,
+			})
+			job.State = Failed
+			job.LeaseKey = ""
+			job.LeaseExpires = 0
+			job.LastUpdated = currentTime
+			c.db.record(newJobEntry(queueName, job))
+			c.resolveDependents(job.UID, Failed, currentTime)
+			c.deadLetterJob(queue, job, operation.Reason, currentTime)
+		}
+	case OperationDelete:
+		c.removeJobs(queue, jobs)
+		for _, job := range jobs {
+			c.resolveDependents(job.UID, Failed, currentTime)
+		}
+	case OperationPriority:
+		for _, job := range jobs {
+			job.Priority = operation.Priority
+			job.LastUpdated = currentTime
+			c.db.record(newJobEntry(queueName, job))
+		}
+	case OperationMove:
+		c.removeJobs(queue, jobs)
+		for _, job := range jobs {
+			job.LastUpdated = currentTime
+			target.appendJob(job)
+			target.indexUnique(job)
+			c.db.moveDependent(job, queueName, target.Name)
+			c.db.record(newJobEntry(target.Name, job))
+		}
+	}
+
+	return len(jobs), nil
+}
+
+// removeJobs removes the given jobs from the queue - must handle Lock outside of this function
+func (c *QueryControl) removeJobs(queue *Queue, jobs []*Job) {
+	for _, job := range jobs {
+		c.removeJob(queue, job)
+	}
+}
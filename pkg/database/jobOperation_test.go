@@ -0,0 +1,31 @@
+package database
+
+import "testing"
+
+func TestJobOperationAffects(t *testing.T) {
+	tests := []struct {
+		op      string
+		state   string
+		affects bool
+	}{
+		{op: OperationRequeue, state: Queued, affects: false},
+		{op: OperationRequeue, state: Inprogress, affects: true},
+		{op: OperationRequeue, state: Complete, affects: true},
+		{op: OperationRequeue, state: Failed, affects: true},
+		{op: OperationRequeue, state: Blocked, affects: false},
+		{op: OperationRequeue, state: DeadLettered, affects: false},
+		{op: OperationFail, state: Queued, affects: true},
+		{op: OperationFail, state: Inprogress, affects: true},
+		{op: OperationFail, state: Complete, affects: false},
+		{op: OperationFail, state: Failed, affects: false},
+		{op: OperationFail, state: Blocked, affects: true},
+		{op: OperationFail, state: DeadLettered, affects: false},
+	}
+
+	for _, test := range tests {
+		operation := &JobOperation{Op: test.op}
+		if affects := operation.affects(&Job{State: test.state}); affects != test.affects {
+			t.Errorf("%s affects %s job = %t, want %t", test.op, test.state, affects, test.affects)
+		}
+	}
+}
@@ -12,5 +12,11 @@ const Complete string = "complete"
 //Failed is the status a job is in once processing has unsuccesfully finished
 const Failed string = "failed"
 
-// ValidStatus is an array holding all the supported status's by the application
+//Blocked is the status a job is at while it waits for the jobs it depends on to complete
+const Blocked string = "blocked"
+
+//DeadLettered is the status a job is in once moved to a dead-letter queue, it is kept there until redriven
+const DeadLettered string = "deadlettered"
+
+// ValidStatus is an array holding all the status's a job can be updated to by the user
 var ValidStatus = [4]string{Queued, Inprogress, Complete, Failed}
@@ -0,0 +1,10 @@
+package database
+
+// defaultLeaseSeconds is the lease duration used when neither the request or the job define one
+const defaultLeaseSeconds int64 = 300
+
+// Lease represents a workers exclusive claim on an inprogress job, the token is only known to the worker holding it
+type Lease struct {
+	Token   string `json:"token"`
+	Expires int64  `json:"expires"`
+}
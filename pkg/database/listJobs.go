@@ -0,0 +1,177 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SortCreated orders listed jobs by the time they were created, the default
+const SortCreated string = "created"
+
+// SortUpdated orders listed jobs by the time they were last updated
+const SortUpdated string = "updated"
+
+// SortPriority orders listed jobs by priority, then the time they were created
+const SortPriority string = "priority"
+
+// defaultListLimit is the number of jobs listed in a page if no limit is given
+const defaultListLimit int = 100
+
+// maxListLimit is the most jobs that can be listed in a page
+const maxListLimit int = 1000
+
+// JobQuery selects a page of jobs within a queue. The sort is one of the sort fields, prefixed with '-' for descending
+// order, and the cursor is the next cursor of the previous page
+type JobQuery struct {
+	Filter *JobFilter
+	Sort   string
+	Limit  int
+	Cursor string
+}
+
+// JobPage represents a page of listed jobs, the next cursor is empty once there are no more jobs to list
+type JobPage struct {
+	Jobs       []*Job `json:"jobs"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// jobCursor records the position of the last job in a page, the UID orders jobs with the same sort key
+type jobCursor struct {
+	Key []int64 `json:"k"`
+	UID string  `json:"u"`
+}
+
+// sortKey returns the values the given sort field orders the job by
+func sortKey(job *Job, field string) []int64 {
+	switch field {
+	case SortUpdated:
+		return []int64{job.LastUpdated}
+	case SortPriority:
+		return []int64{int64(job.Priority), job.Created}
+	default:
+		return []int64{job.Created}
+	}
+}
+
+// compareCursor returns -1, 0 or 1 as the first position is before, the same as or after the second in ascending order
+func compareCursor(a, b *jobCursor) int {
+	for i := range a.Key {
+		if i >= len(b.Key) || a.Key[i] > b.Key[i] {
+			return 1
+		} else if a.Key[i] < b.Key[i] {
+			return -1
+		}
+	}
+	return strings.Compare(a.UID, b.UID)
+}
+
+// encodeCursor returns the cursor for the given position as an opaque string
+func encodeCursor(cursor *jobCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor returns the position held by the given cursor string
+func decodeCursor(value string, field string) (*jobCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor := new(jobCursor)
+	if err = json.Unmarshal(data, cursor); err != nil {
+		return nil, err
+	} else if len(cursor.Key) != len(sortKey(new(Job), field)) {
+		return nil, fmt.Errorf("Cursor Does Not Match Sort")
+	}
+	return cursor, nil
+}
+
+// ListJobs returns a page of the jobs in the given queue matching the query filter in the query sort order. Pages follow
+// on from the cursor of the previous page, so jobs added or removed between requests do not shift the pages
+func (c *QueryControl) ListJobs(query *JobQuery, queueName, accessKey string) (*JobPage, error) {
+	if query == nil || len(queueName) == 0 || len(accessKey) == 0 || query.Limit < 0 || (query.Filter != nil && !query.Filter.Valid()) {
+		return nil, fmt.Errorf("Invalid Args")
+	}
+
+	field := strings.TrimPrefix(query.Sort, "-")
+	descending := strings.HasPrefix(query.Sort, "-")
+	switch {
+	case len(field) == 0:
+		field = SortCreated
+	case field != SortCreated && field != SortUpdated && field != SortPriority:
+		return nil, fmt.Errorf("Invalid Args")
+	}
+
+	limit := query.Limit
+	if limit == 0 {
+		limit = defaultListLimit
+	} else if limit > maxListLimit {
+		limit = maxListLimit
+	}
+
+	var after *jobCursor
+	if len(query.Cursor) > 0 {
+		var err error
+		if after, err = decodeCursor(query.Cursor, field); err != nil {
+			return nil, fmt.Errorf("Invalid Args")
+		}
+	}
+
+	hashedKey, err := c.hash.Process(accessKey)
+	if err != nil {
+		return nil, err
+	}
+
+	defer c.lockQueues(false, queueName)()
+
+	queue, found := c.db.Queues[queueName]
+	if !found {
+		return nil, fmt.Errorf("Not Found")
+	} else if queue.AccessKey != hashedKey {
+		return nil, fmt.Errorf("Unauthorized")
+	}
+
+	// before returns whether the first position comes before the second in the requested order
+	before := func(a, b *jobCursor) bool {
+		if descending {
+			return compareCursor(a, b) > 0
+		}
+		return compareCursor(a, b) < 0
+	}
+
+	type listed struct {
+		position *jobCursor
+		job      *Job
+	}
+
+	matched := make([]*listed, 0)
+	for _, job := range queue.Jobs {
+		if query.Filter != nil && !query.Filter.Match(job) {
+			continue
+		}
+
+		position := &jobCursor{Key: sortKey(job, field), UID: job.UID}
+		if after == nil || before(after, position) {
+			matched = append(matched, &listed{position: position, job: job})
+		}
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		return before(matched[i].position, matched[j].position)
+	})
+
+	page := &JobPage{Jobs: make([]*Job, 0, limit)}
+	for i, item := range matched {
+		if i == limit {
+			page.NextCursor = encodeCursor(matched[i-1].position)
+			break
+		}
+		page.Jobs = append(page.Jobs, item.job.copy())
+	}
+
+	return page, nil
+}
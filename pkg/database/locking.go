@@ -0,0 +1,132 @@
+package database
+
+import (
+	"sort"
+
+	"github.com/MichaelWittgreffe/jobengine/pkg/tracing"
+)
+
+// Locking is split between the database and each queue. The database lock guards the set of queues, it is held for
+// reading while working on the queues and for writing only to add or remove a queue, or to see every queue at once
+// without their own locks. A queue lock guards the jobs, schedules and counters of that queue, and is only taken while
+// the database lock is held for reading. Where more than one queue is locked they are locked in name order, so callers
+// locking overlapping queues cannot deadlock. The journal, waiters and dependents index are shared between queues and
+// guarded by a lock of their own, which is never held while taking another
+
+// resolution is the outcome of a finished job, waiting to be recorded against the jobs blocked on it
+type resolution struct {
+	uid         string
+	outcome     string
+	currentTime int64
+}
+
+// lockDB takes the database lock for writing, recording the time spent waiting for it as a span
+func (c *QueryControl) lockDB() {
+	_, span := tracing.Start(c.ctx, "DBFile.lock")
+	c.db.lock.Lock()
+	span.End()
+}
+
+// unlockDB releases the database lock taken by lockDB, then resolves the dependents of any jobs that finished while it
+// was held
+func (c *QueryControl) unlockDB() {
+	c.db.lock.Unlock()
+	c.resolvePending()
+}
+
+// readLockDB takes the database lock for reading, so queues can be locked in turn without the set of queues changing
+func (c *QueryControl) readLockDB() {
+	_, span := tracing.Start(c.ctx, "DBFile.lock")
+	c.db.lock.RLock()
+	span.End()
+}
+
+// lockQueues takes the database lock for reading and the locks of the given queues, along with their dead-letter queues
+// if deadLetter is set. Queues that do not exist are skipped. Returns the function releasing them, which then resolves
+// the dependents of any jobs that finished while they were held
+func (c *QueryControl) lockQueues(deadLetter bool, names ...string) func() {
+	release := c.acquireQueues(deadLetter, names...)
+	return func() {
+		release()
+		c.resolvePending()
+	}
+}
+
+// acquireQueues takes the locks of lockQueues, returning the function releasing them
+func (c *QueryControl) acquireQueues(deadLetter bool, names ...string) func() {
+	_, span := tracing.Start(c.ctx, "Queue.lock")
+	defer span.End()
+
+	c.db.lock.RLock()
+
+	selected := make(map[string]*Queue, len(names))
+	for _, name := range names {
+		queue, found := c.db.Queues[name]
+		if !found {
+			continue
+		}
+		selected[name] = queue
+		if deadLetter {
+			if deadLetterQueue, found := c.db.Queues[queue.DeadLetterQueue]; found {
+				selected[deadLetterQueue.Name] = deadLetterQueue
+			}
+		}
+	}
+
+	ordered := make([]string, 0, len(selected))
+	for name := range selected {
+		ordered = append(ordered, name)
+	}
+	sort.Strings(ordered)
+
+	for _, name := range ordered {
+		selected[name].lock.Lock()
+	}
+
+	return func() {
+		for i := len(ordered) - 1; i >= 0; i-- {
+			selected[ordered[i]].lock.Unlock()
+		}
+		c.db.lock.RUnlock()
+	}
+}
+
+// dependencyQueues returns the names of the queues holding the parents of the given jobs
+func dependencyQueues(jobs ...*Job) []string {
+	result := make([]string, 0)
+	for _, job := range jobs {
+		if job == nil {
+			continue
+		}
+		for _, dependency := range job.DependsOn {
+			if dependency != nil {
+				result = append(result, dependency.QueueName)
+			}
+		}
+	}
+	return result
+}
+
+// resolvePending records the outcome of every finished job waiting to be resolved against the jobs blocked on it, each
+// under the lock of the queue the blocked job is in. Resolving a job may finish others, which are resolved in turn
+func (c *QueryControl) resolvePending() {
+	for {
+		c.db.shared.Lock()
+		if len(c.db.resolutions) == 0 {
+			c.db.shared.Unlock()
+			return
+		}
+		next := c.db.resolutions[0]
+		c.db.resolutions[0] = nil
+		c.db.resolutions = c.db.resolutions[1:]
+		refs := c.db.dependents[next.uid]
+		delete(c.db.dependents, next.uid)
+		c.db.shared.Unlock()
+
+		for _, ref := range refs {
+			release := c.acquireQueues(false, ref.queueName)
+			c.resolveDependent(ref, next)
+			release()
+		}
+	}
+}
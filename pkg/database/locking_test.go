@@ -0,0 +1,88 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/MichaelWittgreffe/jobengine/pkg/filesystem"
+)
+
+// blockingFileSystem is the os file system with WriteFile held until release is closed, entered is closed once a write
+// is held
+type blockingFileSystem struct {
+	filesystem.FileSystem
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (f *blockingFileSystem) WriteFile(filepath string, data []byte) error {
+	close(f.entered)
+	<-f.release
+	return f.FileSystem.WriteFile(filepath, data)
+}
+
+// claimAndComplete claims and completes count jobs of the queue, failing the test if they are not done within a second
+func claimAndComplete(t *testing.T, controller QueryController, queueName string, count int) {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() {
+		for i := 0; i < count; i++ {
+			job, lease, err := controller.ClaimNextJob(queueName, testKey, 60)
+			if err == nil && job != nil {
+				err = controller.UpdateJobStatus(job.UID, Complete, lease.Token, "", queueName, testKey)
+			}
+			if err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("claiming jobs of %s: %s", queueName, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("jobs of %s not claimed and completed while another queue is busy", queueName)
+	}
+}
+
+func TestQueueProgressesWhileAnotherIsLocked(t *testing.T) {
+	_, controller := newTestController(t, "busy", "other")
+	addTestJobs(t, controller, "busy", 1, 0)
+	addTestJobs(t, controller, "other", 3, 0)
+
+	release := controller.lockQueues(false, "busy")
+	claimAndComplete(t, controller, "other", 3)
+	release()
+
+	claimAndComplete(t, controller, "busy", 1)
+}
+
+func TestQueueProgressesWhileSaving(t *testing.T) {
+	db, controller := newTestController(t, "busy", "other")
+	addTestJobs(t, controller, "busy", 1, 0)
+	addTestJobs(t, controller, "other", 3, 0)
+
+	fileSystem := &blockingFileSystem{
+		FileSystem: filesystem.NewFileSystem("os"),
+		entered:    make(chan struct{}),
+		release:    make(chan struct{}),
+	}
+	handler, path := newTestFileHandler(t, "fs", fileSystem), newTestPath(t)
+	saved := make(chan error, 1)
+	go func() {
+		saved <- handler.SaveToFile(db, path)
+	}()
+	<-fileSystem.entered
+
+	claimAndComplete(t, controller, "other", 3)
+	claimAndComplete(t, controller, "busy", 1)
+
+	close(fileSystem.release)
+	if err := <-saved; err != nil {
+		t.Fatalf("SaveToFile: %s", err)
+	}
+}
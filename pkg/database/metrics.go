@@ -0,0 +1,57 @@
+package database
+
+import (
+	"sort"
+	"time"
+
+	"github.com/MichaelWittgreffe/jobengine/pkg/metrics"
+)
+
+// Collect returns the job counts, rates and durations of every queue as metrics, read from the counters kept as jobs
+// change without checking access keys
+func (c *QueryControl) Collect() []*metrics.Family {
+	c.readLockDB()
+	defer c.db.lock.RUnlock()
+
+	depth := metrics.NewFamily("jobengine_queue_jobs", "Number of jobs in the queue at each status", metrics.Gauge)
+	oldest := metrics.NewFamily("jobengine_queue_oldest_queued_seconds", "Seconds the longest waiting queued job has been queued for", metrics.Gauge)
+	enqueued := metrics.NewFamily("jobengine_jobs_enqueued_total", "Number of jobs added to the queue, including those moved into it", metrics.Counter)
+	dequeued := metrics.NewFamily("jobengine_jobs_dequeued_total", "Number of times jobs have been set to inprogress", metrics.Counter)
+	completed := metrics.NewFamily("jobengine_jobs_completed_total", "Number of times jobs have been set to complete", metrics.Counter)
+	failed := metrics.NewFamily("jobengine_jobs_failed_total", "Number of times jobs have been set to failed", metrics.Counter)
+	waitTimes := metrics.NewFamily("jobengine_job_wait_seconds", "Seconds jobs were queued before being set to inprogress", metrics.HistogramType)
+	runTimes := metrics.NewFamily("jobengine_job_run_seconds", "Seconds jobs were inprogress for", metrics.HistogramType)
+
+	names := make([]string, 0, len(c.db.Queues))
+	for name := range c.db.Queues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	currentTime := time.Now().Unix()
+	for _, name := range names {
+		queue := c.db.Queues[name]
+		queue.lock.Lock()
+		stats := queue.jobStats()
+		label := metrics.Label{Name: "queue", Value: name}
+
+		for _, state := range []string{Queued, Inprogress, Complete, Failed, Blocked, DeadLettered} {
+			depth.Add(float64(stats.counts[state]), label, metrics.Label{Name: "state", Value: state})
+		}
+		if since := stats.oldestQueued(); since > 0 && currentTime > since {
+			oldest.Add(float64(currentTime-since), label)
+		} else {
+			oldest.Add(0, label)
+		}
+
+		enqueued.Add(float64(stats.enqueued), label)
+		dequeued.Add(float64(stats.dequeued), label)
+		completed.Add(float64(stats.completed), label)
+		failed.Add(float64(stats.failed), label)
+		waitTimes.AddHistogram(stats.waitTimes, label)
+		runTimes.AddHistogram(stats.runTimes, label)
+		queue.lock.Unlock()
+	}
+
+	return []*metrics.Family{depth, oldest, enqueued, dequeued, completed, failed, waitTimes, runTimes}
+}
@@ -1,63 +1,237 @@
 package database
 
 import (
-	"fmt"
+	"context"
+	"sync"
+	"time"
 
 	"github.com/MichaelWittgreffe/jobengine/pkg/logger"
+	"github.com/MichaelWittgreffe/jobengine/pkg/metrics"
 )
 
 // DBMonitor presents an object for write requests and start monitoring the DB
 type DBMonitor interface {
 	Write()
+	Commit(ctx context.Context) error
 	Start()
+	Stop(ctx context.Context) error
+	Flush(ctx context.Context) error
+	Collect() []*metrics.Family
 }
 
-// DBFileMonitor is an object responsible for writing changes to the DBFile object to the database
+// DBFileMonitor is an object responsible for writing changes to the DBFile object to the database. Write requests are
+// coalesced, a save is made once no further write has been requested for minInterval or once the oldest unsaved request
+// is maxStaleness old, whichever is first
 type DBFileMonitor struct {
-	dbFile      *DBFile
-	dbFilePath  string
-	fileHandler DBFileHandler
-	flag        chan bool
-	log         logger.Logger
+	dbFile        *DBFile
+	dbFilePath    string
+	fileHandler   DBFileHandler
+	minInterval   time.Duration
+	maxStaleness  time.Duration
+	requestLock   *sync.Mutex
+	pending       bool
+	firstRequest  time.Time
+	lastRequest   time.Time
+	waiters       []chan error
+	stopped       bool
+	wake          chan struct{}
+	stop          chan struct{}
+	done          chan struct{}
+	log           logger.Logger
+	saveTimes     *metrics.HistogramVec
+	saveErrors    *metrics.CounterVec
+	fileSize      *metrics.GaugeVec
+	writeRequests *metrics.CounterVec
 }
 
-// NewDBFileMonitor is a constructor for the DBFileMonitor type
-func NewDBFileMonitor(dbFile *DBFile, filePath string, dbFileHandler DBFileHandler, logger logger.Logger) DBMonitor {
-	if dbFileHandler == nil {
+// NewDBFileMonitor is a constructor for the DBFileMonitor type, maxStaleness must be at least minInterval
+func NewDBFileMonitor(dbFile *DBFile, filePath string, dbFileHandler DBFileHandler, logger logger.Logger, minInterval, maxStaleness time.Duration) DBMonitor {
+	if dbFileHandler == nil || minInterval < 0 || maxStaleness < minInterval {
 		return nil
 	}
 
-	writeFlag := make(chan bool, 1)
-	writeFlag <- false
-
 	return &DBFileMonitor{
-		dbFile:      dbFile,
-		dbFilePath:  filePath,
-		fileHandler: dbFileHandler,
-		flag:        writeFlag,
-		log:         logger,
+		dbFile:        dbFile,
+		dbFilePath:    filePath,
+		fileHandler:   dbFileHandler,
+		minInterval:   minInterval,
+		maxStaleness:  maxStaleness,
+		requestLock:   new(sync.Mutex),
+		wake:          make(chan struct{}, 1),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+		log:           logger,
+		saveTimes:     metrics.NewHistogramVec("jobengine_db_save_seconds", "Seconds taken to save changes to the database file", metrics.DefaultBuckets),
+		saveErrors:    metrics.NewCounterVec("jobengine_db_save_failures_total", "Number of saves to the database file that failed"),
+		fileSize:      metrics.NewGaugeVec("jobengine_db_file_bytes", "Size of the database file after the last save"),
+		writeRequests: metrics.NewCounterVec("jobengine_db_write_requests_total", "Number of writes requested of the database file, many are coalesced into each save"),
 	}
 }
 
-// Write requests the DBFile to be written to file
+// Write requests the DBFile to be written to file, never blocks - the request is coalesced with any others made before
+// the next save
 func (m *DBFileMonitor) Write() {
-	m.flag <- true
+	m.request(nil)
+}
+
+// Commit requests the DBFile to be written to file and waits until it has been, returning the error of the save. Commits
+// are saved without waiting for further requests, returns the error of ctx if it ends first
+func (m *DBFileMonitor) Commit(ctx context.Context) error {
+	result := make(chan error, 1)
+	if !m.request(result) {
+		// the monitor has stopped, so there is no save to wait for
+		return m.Flush(ctx)
+	}
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
-// Start begins the monitoring and write process, blocks current goroutine with infinite loop
+// request records a write request and wakes the write process, the result of the save is sent to waiter if it is given.
+// Returns false without recording the request if the monitor has stopped
+func (m *DBFileMonitor) request(waiter chan error) bool {
+	m.requestLock.Lock()
+	defer m.requestLock.Unlock()
+
+	m.writeRequests.Inc()
+	now := time.Now()
+	if waiter != nil {
+		if m.stopped {
+			return false
+		}
+		m.waiters = append(m.waiters, waiter)
+	}
+	if !m.pending {
+		m.pending = true
+		m.firstRequest = now
+	}
+	m.lastRequest = now
+
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// nextSave returns when the requested writes should be saved, returns false if no write has been requested
+func (m *DBFileMonitor) nextSave() (time.Time, bool) {
+	m.requestLock.Lock()
+	defer m.requestLock.Unlock()
+
+	if !m.pending {
+		return time.Time{}, false
+	} else if len(m.waiters) > 0 {
+		return time.Now(), true
+	}
+
+	due := m.lastRequest.Add(m.minInterval)
+	if latest := m.firstRequest.Add(m.maxStaleness); latest.Before(due) {
+		due = latest
+	}
+	return due, true
+}
+
+// Start begins the monitoring and write process, blocks current goroutine until Stop is called
 func (m *DBFileMonitor) Start() {
-	for true {
+	defer close(m.done)
+
+	var timer <-chan time.Time
+	for {
 		select {
-		case writeFlag, open := <-m.flag:
-			if open {
-				if writeFlag {
-					if err := m.fileHandler.SaveToFile(m.dbFile, m.dbFilePath); err != nil {
-						m.log.Error(fmt.Sprintf("Error Saving DB File: %s", err.Error()))
-					}
-				}
-			} else {
-				m.log.Error("DBFile Monitor Write Channel Closed")
-			}
+		case <-m.wake:
+		case <-timer:
+		case <-m.stop:
+			return
+		}
+
+		due, pending := m.nextSave()
+		if !pending {
+			timer = nil
+		} else if wait := time.Until(due); wait > 0 {
+			timer = time.After(wait)
+		} else {
+			timer = nil
+			m.commit()
 		}
 	}
 }
+
+// Stop ends the write process started by Start, waiting for any write in progress to finish, then flushes the DBFile
+// to file. Returns the error from the flush, or the error of ctx if it ends first
+func (m *DBFileMonitor) Stop(ctx context.Context) error {
+	m.requestLock.Lock()
+	if !m.stopped {
+		m.stopped = true
+		close(m.stop)
+	}
+	m.requestLock.Unlock()
+
+	select {
+	case <-m.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return m.Flush(ctx)
+}
+
+// Flush writes the DBFile to file and waits for it to finish, returns the error of ctx if it ends first
+func (m *DBFileMonitor) Flush(ctx context.Context) error {
+	result := make(chan error, 1)
+	go func() {
+		result <- m.commit()
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// commit saves the DBFile, sending the result to everything waiting on the requests it covers
+func (m *DBFileMonitor) commit() error {
+	m.requestLock.Lock()
+	waiters := m.waiters
+	m.waiters = nil
+	m.pending = false
+	m.requestLock.Unlock()
+
+	err := m.save()
+	for _, waiter := range waiters {
+		waiter <- err
+	}
+	return err
+}
+
+// save writes the changes to the DBFile to the database, recording how long it took and the resulting file size
+func (m *DBFileMonitor) save() error {
+	started := time.Now()
+	err := m.fileHandler.SaveToFile(m.dbFile, m.dbFilePath)
+	m.saveTimes.Observe(time.Since(started).Seconds())
+
+	if err != nil {
+		m.saveErrors.Inc()
+		m.log.Error("Error Saving DB File", logger.F("path", m.dbFilePath), logger.F("error", err))
+		return err
+	}
+
+	if size, err := m.fileHandler.FileSize(m.dbFilePath); err == nil {
+		m.fileSize.Set(float64(size))
+	}
+	return nil
+}
+
+// Collect returns the write requests, save durations, failures and file size of the database as metrics
+func (m *DBFileMonitor) Collect() []*metrics.Family {
+	result := m.saveTimes.Collect()
+	result = append(result, m.saveErrors.Collect()...)
+	result = append(result, m.writeRequests.Collect()...)
+	return append(result, m.fileSize.Collect()...)
+}
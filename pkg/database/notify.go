@@ -0,0 +1,30 @@
+package database
+
+// WaitForJob returns a channel that is closed the next time a job in the given queue is set to 'queued' or the queue is
+// deleted, the job may not be avalible yet if it is delayed. Returns nil if the queue does not exist
+func (c *QueryControl) WaitForJob(queueName string) <-chan struct{} {
+	c.readLockDB()
+	defer c.db.lock.RUnlock()
+
+	if _, found := c.db.Queues[queueName]; !found {
+		return nil
+	}
+
+	c.db.shared.Lock()
+	defer c.db.shared.Unlock()
+
+	waiter, found := c.db.waiters[queueName]
+	if !found {
+		waiter = make(chan struct{})
+		c.db.waiters[queueName] = waiter
+	}
+	return waiter
+}
+
+// notify wakes everything waiting on the given queue - must handle the shared Lock outside of this function
+func (db *DBFile) notify(queueName string) {
+	if waiter, found := db.waiters[queueName]; found {
+		close(waiter)
+		delete(db.waiters, queueName)
+	}
+}
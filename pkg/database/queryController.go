@@ -1,49 +1,102 @@
 package database
 
 import (
+	"context"
 	"fmt"
-	"sort"
+	"sync"
 	"time"
 
 	"github.com/MichaelWittgreffe/jobengine/pkg/crypto"
+	"github.com/MichaelWittgreffe/jobengine/pkg/logger"
+	"github.com/MichaelWittgreffe/jobengine/pkg/metrics"
+	"github.com/google/uuid"
 )
 
 // QueryController defines an object used to make queries to the database
 type QueryController interface {
-	CreateQueue(name, accessKey string) error
+	WithContext(ctx context.Context) QueryController
+	CreateQueue(name, accessKey string, options *QueueOptions) error
 	GetQueue(name, accessKey string) (*Queue, error)
 	UpdateQueue(queueName string) error
+	Durability(queueName string) string
 	DeleteQueue(name, accessKey string) error
-	AddJob(job *Job, queueName, accessKey string, sort bool) error
+	AddJob(job *Job, queueName, accessKey string) (*Job, bool, error)
+	AddJobs(jobs []*BulkJob, accessKey string, atomic bool) ([]*BulkResult, error)
+	ApplyJobOperation(operation *JobOperation, queueName, accessKey string, dryRun bool) (int, error)
 	GetJob(uid, queueName, accessKey string) (*Job, error)
 	GetNextJob(queueName, accessKey string) (*Job, error)
+	WaitForJob(queueName string) <-chan struct{}
+	ClaimNextJob(queueName, accessKey string, leaseSeconds int64) (*Job, *Lease, error)
+	ClaimNextJobs(queueName, accessKey string, count int, leaseSeconds int64) ([]*Job, []*Lease, error)
 	GetAllJobs(queueName, accessKey string) ([]*Job, error)
-	UpdateJobStatus(uid, newStatus, queueName, accessKey string) error
+	ListJobs(query *JobQuery, queueName, accessKey string) (*JobPage, error)
+	GetQueueStats(queueName, accessKey string) (*QueueStats, error)
+	GetAllStats(accessKey string) (*StatsSummary, error)
+	Collect() []*metrics.Family
+	UpdateJobStatus(uid, newStatus, leaseToken, message, queueName, accessKey string) error
+	ExtendLease(uid, leaseToken string, leaseSeconds int64, queueName, accessKey string) (*Lease, error)
 	DeleteJob(uid, queueName, accessKey string) error
+	RejectJob(uid, leaseToken, reason, queueName, accessKey string) error
+	GetDeadLetterJobs(queueName, accessKey string) ([]*Job, error)
+	RedriveJobs(uids []string, queueName, accessKey string) (int, error)
+	CreateSchedule(schedule *Schedule, queueName, accessKey string) error
+	GetSchedules(queueName, accessKey string) ([]*Schedule, error)
+	DeleteSchedule(name, queueName, accessKey string) error
+	RunSchedules(currentTime int64) (int, int, error)
+	AddWorkflow(workflow *Workflow, accessKey string) (*Workflow, error)
+	GetWorkflow(workflowID, queueName, accessKey string) (*WorkflowStatus, error)
 }
 
 // QueryControl object is used to make queries to the database
 type QueryControl struct {
 	db   *DBFile
 	hash crypto.HashHandler
+	ctx  context.Context
+	log  logger.Logger
 }
 
 // NewQueryController is a constructor for the QueryController interface
-func NewQueryController(db *DBFile, hasher crypto.HashHandler) QueryController {
-	if db == nil {
+func NewQueryController(db *DBFile, hasher crypto.HashHandler, logger logger.Logger) QueryController {
+	if db == nil || logger == nil {
 		return nil
 	}
 
 	return &QueryControl{
 		db:   db,
 		hash: hasher,
+		ctx:  context.Background(),
+		log:  logger,
 	}
 }
 
-// CreateQueue creates a new queue entry
-func (c *QueryControl) CreateQueue(name, accessKey string) error {
+// WithContext returns a copy of the controller making queries as part of the request of ctx, messages are logged with
+// the fields of the request and the time spent waiting for the database and queue locks is recorded as spans if it is
+// traced
+func (c *QueryControl) WithContext(ctx context.Context) QueryController {
+	return &QueryControl{
+		db:   c.db,
+		hash: c.hash,
+		ctx:  ctx,
+		log:  c.log,
+	}
+}
+
+// logger returns the logger of the request the controller is making queries for, so messages carry its fields, or the
+// logger of the controller outside of a request
+func (c *QueryControl) logger() logger.Logger {
+	if requestLogger := logger.FromContext(c.ctx); requestLogger != nil {
+		return requestLogger
+	}
+	return c.log
+}
+
+// CreateQueue creates a new queue entry, options may be nil to use the defaults. A dead-letter queue must already exist
+// with the same access key
+func (c *QueryControl) CreateQueue(name, accessKey string, options *QueueOptions) error {
 	if len(name) == 0 || len(accessKey) == 0 {
 		return fmt.Errorf("Invalid Arg")
+	} else if options == nil {
+		options = new(QueueOptions)
 	}
 
 	hashedKey, err := c.hash.Process(accessKey)
@@ -51,19 +104,32 @@ func (c *QueryControl) CreateQueue(name, accessKey string) error {
 		return err
 	}
 
-	c.db.lock.Lock()
-	defer c.db.lock.Unlock()
+	c.lockDB()
+	defer c.unlockDB()
 
 	if _, found := c.db.Queues[name]; found {
 		return fmt.Errorf("Queue Exists")
+	} else if options.IdempotencyWindowSeconds < 0 || !validUniqueOptions(options.UniqueFields, options.UniqueConflict) || !validDurability(options.Durability) {
+		return fmt.Errorf("Invalid Arg")
+	} else if len(options.DeadLetterQueue) > 0 {
+		// a queue of another access key is rejected as if it does not exist, so it cannot be sent jobs or found this way
+		if deadLetterQueue, found := c.db.Queues[options.DeadLetterQueue]; !found || options.DeadLetterQueue == name || deadLetterQueue.AccessKey != hashedKey {
+			return fmt.Errorf("Invalid Arg")
+		}
 	}
 
-	c.db.Queues[name] = &Queue{
-		Name:      name,
-		AccessKey: hashedKey,
-		Size:      0,
-		Jobs:      make([]*Job, 0),
+	queue := &Queue{
+		Name:         name,
+		AccessKey:    hashedKey,
+		Size:         0,
+		Jobs:         make([]*Job, 0),
+		Schedules:    make(map[string]*Schedule),
+		QueueOptions: *options,
+		lock:         new(sync.Mutex),
 	}
+	c.db.Queues[name] = queue
+	c.db.record(newQueueEntry(queue))
+	c.logger().Info("Queue Created", logger.F("queue", name))
 
 	return nil
 }
@@ -79,12 +145,11 @@ func (c *QueryControl) GetQueue(name, accessKey string) (*Queue, error) {
 		return nil, err
 	}
 
-	c.db.lock.Lock()
-	defer c.db.lock.Unlock()
+	defer c.lockQueues(false, name)()
 
 	if result, found := c.db.Queues[name]; found {
 		if hashedKey == result.AccessKey {
-			return result, nil
+			return result.copy(), nil
 		}
 		return nil, fmt.Errorf("Unauthorized")
 	}
@@ -103,8 +168,8 @@ func (c *QueryControl) DeleteQueue(name, accessKey string) error {
 		return err
 	}
 
-	c.db.lock.Lock()
-	defer c.db.lock.Unlock()
+	c.lockDB()
+	defer c.unlockDB()
 
 	queue, found := c.db.Queues[name]
 	if !found {
@@ -114,38 +179,86 @@ func (c *QueryControl) DeleteQueue(name, accessKey string) error {
 	}
 
 	delete(c.db.Queues, name)
+	c.db.record(&WALEntry{Op: WALDeleteQueue, QueueName: name})
+	c.logger().Info("Queue Deleted", logger.F("queue", name))
+
+	currentTime := time.Now().Unix()
+	for _, job := range queue.Jobs {
+		c.resolveDependents(job.UID, Failed, currentTime)
+	}
 	return nil
 }
 
-// AddJob adds the given job to the given queue name in priority order (100 at head, 0 at tail)
-func (c *QueryControl) AddJob(job *Job, queueName, accessKey string, sort bool) error {
-	if job == nil || len(queueName) == 0 || len(accessKey) == 0 {
-		return fmt.Errorf("Invalid Args")
+// AddJob adds the given job to the given queue name in priority order (100 at head, 0 at tail), jobs with a run at time
+// are not avalible for processing until then. Jobs depending on others are 'blocked' until their parents complete. If
+// the jobs idempotency key has already been used in the queue within its window, the original job is returned instead
+// and nothing is added. A job matching the unique fields of an active job is rejected, or merged into it and the active
+// job returned if the queue is set to merge. Returns a copy of the job held by the queue, made before the lock of the
+// queue is released, and whether the given job was added
+func (c *QueryControl) AddJob(job *Job, queueName, accessKey string) (*Job, bool, error) {
+	if job == nil || len(queueName) == 0 || len(accessKey) == 0 || !validJob(job) {
+		return nil, false, fmt.Errorf("Invalid Args")
 	}
 
 	hashedKey, err := c.hash.Process(accessKey)
 	if err != nil {
-		return err
+		return nil, false, err
 	}
 
-	c.db.lock.Lock()
-	defer c.db.lock.Unlock()
+	defer c.lockQueues(false, append(dependencyQueues(job), queueName)...)()
 
 	queue, found := c.db.Queues[queueName]
 	if !found {
-		return fmt.Errorf("Not Found")
+		return nil, false, fmt.Errorf("Not Found")
 	} else if queue.AccessKey != hashedKey {
-		return fmt.Errorf("Unauthorized")
+		return nil, false, fmt.Errorf("Unauthorized")
 	}
 
-	queue.Jobs = append(queue.Jobs, job)
-	queue.Size++
+	existing, err := c.addJob(queue, job, time.Now().Unix())
+	if err != nil {
+		return nil, false, err
+	} else if existing != nil {
+		return existing, false, nil
+	}
+	return job.copy(), true, nil
+}
 
-	if sort {
-		c.sortQueue(queue)
+// addJob adds the given job to the end of the queue, returning the original job instead if the job repeats an idempotency
+// key or is merged by its unique fields - must handle Lock outside of this function
+func (c *QueryControl) addJob(queue *Queue, job *Job, currentTime int64) (*Job, error) {
+	if len(job.IdempotencyKey) > 0 {
+		if existing := c.findIdempotentJob(queue, job.IdempotencyKey, currentTime); existing != nil {
+			c.logger().Debug("Idempotency Key Repeated", logger.F("queue", queue.Name), logger.F("uid", existing.UID))
+			return existing.copy(), nil
+		}
 	}
 
-	return nil
+	if !c.validateDependencies(job, nil) {
+		return nil, fmt.Errorf("Invalid Args")
+	}
+
+	if existing := queue.uniqueConflict(job); existing != nil {
+		if queue.UniqueConflict != UniqueMerge {
+			return nil, fmt.Errorf("Job Exists")
+		} else if job.Priority > existing.Priority {
+			existing.Priority = job.Priority
+			existing.LastUpdated = currentTime
+			c.db.record(newJobEntry(queue.Name, existing))
+		}
+		c.logger().Debug("Job Merged", logger.F("queue", queue.Name), logger.F("uid", existing.UID))
+		return existing.copy(), nil
+	}
+
+	c.insertJob(queue, job, currentTime)
+	c.logger().Debug("Job Added", logger.F("queue", queue.Name), logger.F("uid", job.UID), logger.F("state", job.State))
+
+	if len(job.IdempotencyKey) > 0 {
+		record := &IdempotencyKey{UID: job.UID, Expires: currentTime + queue.idempotencyWindow()}
+		queue.putIdempotencyKey(job.IdempotencyKey, record)
+		c.db.record(&WALEntry{Op: WALPutIdempotencyKey, QueueName: queue.Name, Name: job.IdempotencyKey, Key: record})
+	}
+
+	return nil, nil
 }
 
 // GetJob returns the given job UID's entry, nil if job cannot be found
@@ -159,8 +272,7 @@ func (c *QueryControl) GetJob(uid, queueName, accessKey string) (*Job, error) {
 		return nil, err
 	}
 
-	c.db.lock.Lock()
-	defer c.db.lock.Unlock()
+	defer c.lockQueues(false, queueName)()
 
 	queue, found := c.db.Queues[queueName]
 	if !found {
@@ -169,16 +281,14 @@ func (c *QueryControl) GetJob(uid, queueName, accessKey string) (*Job, error) {
 		return nil, fmt.Errorf("Unauthorized")
 	}
 
-	for _, job := range queue.Jobs {
-		if job.UID == uid {
-			return job, nil
-		}
+	if job := queue.lookup(uid); job != nil {
+		return job.copy(), nil
 	}
 
 	return nil, nil
 }
 
-// GetNextJob returns the next job in the queue from the head that is not marked as 'inprogress', nil if not found or none avalible
+// GetNextJob returns the next job in the queue from the head that is avalible for processing, nil if not found or none avalible
 func (c *QueryControl) GetNextJob(queueName, accessKey string) (*Job, error) {
 	if len(queueName) == 0 || len(accessKey) == 0 {
 		return nil, fmt.Errorf("Invalid Args")
@@ -189,8 +299,7 @@ func (c *QueryControl) GetNextJob(queueName, accessKey string) (*Job, error) {
 		return nil, err
 	}
 
-	c.db.lock.Lock()
-	defer c.db.lock.Unlock()
+	defer c.lockQueues(false, queueName)()
 
 	queue, found := c.db.Queues[queueName]
 	if !found {
@@ -199,15 +308,65 @@ func (c *QueryControl) GetNextJob(queueName, accessKey string) (*Job, error) {
 		return nil, fmt.Errorf("Unauthorized")
 	}
 
-	for _, job := range queue.Jobs {
-		if job.State == Queued {
-			return job, nil
-		}
+	if job := queue.nextJob(time.Now().Unix()); job != nil {
+		return job.copy(), nil
 	}
 
 	return nil, nil
 }
 
+// ClaimNextJob leases the next job in the queue from the head that is avalible for processing in a single operation, so concurrent
+// callers never receive the same job. Returns a copy of the claimed job, nil if none avalible
+func (c *QueryControl) ClaimNextJob(queueName, accessKey string, leaseSeconds int64) (*Job, *Lease, error) {
+	jobs, leases, err := c.ClaimNextJobs(queueName, accessKey, 1, leaseSeconds)
+	if err != nil || len(jobs) == 0 {
+		return nil, nil, err
+	}
+	return jobs[0], leases[0], nil
+}
+
+// ClaimNextJobs leases up to count jobs avalible for processing from the head of the queue in a single operation, returns
+// copies of the claimed jobs with the lease held on each at the same index, empty if none avalible
+func (c *QueryControl) ClaimNextJobs(queueName, accessKey string, count int, leaseSeconds int64) ([]*Job, []*Lease, error) {
+	if len(queueName) == 0 || len(accessKey) == 0 || count < 1 || leaseSeconds < 0 {
+		return nil, nil, fmt.Errorf("Invalid Args")
+	}
+
+	hashedKey, err := c.hash.Process(accessKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer c.lockQueues(false, queueName)()
+
+	queue, found := c.db.Queues[queueName]
+	if !found {
+		return nil, nil, fmt.Errorf("Not Found")
+	} else if queue.AccessKey != hashedKey {
+		return nil, nil, fmt.Errorf("Unauthorized")
+	}
+
+	currentTime := time.Now().Unix()
+	jobs := make([]*Job, 0, count)
+	leases := make([]*Lease, 0, count)
+	for len(jobs) < count {
+		job := queue.nextJob(currentTime)
+		if job == nil {
+			break
+		}
+
+		// the job is no longer 'queued' once leased, so the next job is avalible in its place
+		lease, err := c.grantLease(queue, job, leaseSeconds)
+		if err != nil {
+			return nil, nil, err
+		}
+		jobs = append(jobs, job.copy())
+		leases = append(leases, lease)
+	}
+
+	return jobs, leases, nil
+}
+
 // GetAllJobs returns all the jobs for a given queue
 func (c *QueryControl) GetAllJobs(queueName, accessKey string) ([]*Job, error) {
 	if len(queueName) == 0 || len(accessKey) == 0 {
@@ -219,8 +378,7 @@ func (c *QueryControl) GetAllJobs(queueName, accessKey string) ([]*Job, error) {
 		return nil, err
 	}
 
-	c.db.lock.Lock()
-	defer c.db.lock.Unlock()
+	defer c.lockQueues(false, queueName)()
 
 	queue, found := c.db.Queues[queueName]
 	if !found {
@@ -229,11 +387,14 @@ func (c *QueryControl) GetAllJobs(queueName, accessKey string) ([]*Job, error) {
 		return nil, fmt.Errorf("Unauthorized")
 	}
 
-	return queue.Jobs, nil
+	return copyJobs(queue.ordered()), nil
 }
 
-// UpdateJobStatus updates the given jobs status
-func (c *QueryControl) UpdateJobStatus(uid, newStatus, queueName, accessKey string) error {
+// UpdateJobStatus updates the given jobs status, the lease token must be given if the job is leased by a worker. A job
+// set to 'failed' is re-queued if it has attempts remaining, the message is kept in its retry history. A finished job
+// cannot be made active again while another active job has the same unique field values. A 'blocked' job can only be
+// set to 'failed', cancelling it
+func (c *QueryControl) UpdateJobStatus(uid, newStatus, leaseToken, message, queueName, accessKey string) error {
 	if !c.validStatus(newStatus) || len(uid) == 0 || len(queueName) == 0 || len(accessKey) == 0 {
 		return fmt.Errorf("Invalid Args")
 	}
@@ -243,8 +404,7 @@ func (c *QueryControl) UpdateJobStatus(uid, newStatus, queueName, accessKey stri
 		return err
 	}
 
-	c.db.lock.Lock()
-	defer c.db.lock.Unlock()
+	defer c.lockQueues(true, queueName)()
 
 	queue, found := c.db.Queues[queueName]
 	if !found {
@@ -253,25 +413,102 @@ func (c *QueryControl) UpdateJobStatus(uid, newStatus, queueName, accessKey stri
 		return fmt.Errorf("Unauthorized")
 	}
 
-	for _, job := range queue.Jobs {
-		if job.UID == uid {
-			job.State = newStatus
-			job.LastUpdated = time.Now().Unix()
-			return nil
+	job := queue.lookup(uid)
+	if job == nil {
+		return fmt.Errorf("Not Found")
+	} else if err = c.checkLease(job, leaseToken); err != nil {
+		return err
+	}
+
+	if job.State == Blocked && newStatus != Failed {
+		// a blocked job is only released by its parents finishing, it can be cancelled but not started early
+		return fmt.Errorf("Job Blocked")
+	} else if job.State == Blocked {
+		c.cancelBlocked(queue, job, message, time.Now().Unix())
+		return nil
+	} else if !uniqueActive(job) && (newStatus == Queued || newStatus == Inprogress) && queue.uniqueConflict(job) != nil {
+		// the finished job cannot be made active again alongside another with the same unique field values
+		return fmt.Errorf("Job Exists")
+	} else if newStatus == Failed {
+		if c.failJob(queue, job, message, time.Now().Unix()) {
+			c.deadLetterJob(queue, job, message, time.Now().Unix())
 		}
+		return nil
+	} else if newStatus == Inprogress && job.State != Inprogress {
+		job.Attempts++
+	}
+
+	job.State = newStatus
+	job.LastUpdated = time.Now().Unix()
+	if newStatus != Inprogress {
+		job.LeaseKey = ""
+		job.LeaseExpires = 0
+	}
+	queue.indexUnique(job)
+	c.db.record(newJobEntry(queueName, job))
+	c.logger().Debug("Job Status Updated", logger.F("queue", queueName), logger.F("uid", uid), logger.F("state", newStatus))
+
+	if newStatus == Complete {
+		c.resolveDependents(uid, Complete, job.LastUpdated)
+	}
+	return nil
+}
+
+// cancelBlocked marks the given blocked job as 'failed' without waiting on its parents, the jobs depending on it are
+// resolved as failed. It is not retried or dead-lettered as it never ran - must handle Lock outside of this function
+func (c *QueryControl) cancelBlocked(queue *Queue, job *Job, message string, currentTime int64) {
+	job.State = Failed
+	job.FailureReason = message
+	job.LastUpdated = currentTime
+	c.db.record(newJobEntry(queue.Name, job))
+	c.logger().Debug("Job Cancelled", logger.F("queue", queue.Name), logger.F("uid", job.UID))
+	c.resolveDependents(job.UID, Failed, currentTime)
+}
+
+// ExtendLease renews the lease held on the given job for a further duration in seconds from now, the jobs timeout is
+// used as the duration if 0
+func (c *QueryControl) ExtendLease(uid, leaseToken string, leaseSeconds int64, queueName, accessKey string) (*Lease, error) {
+	if len(uid) == 0 || len(leaseToken) == 0 || leaseSeconds < 0 || len(queueName) == 0 || len(accessKey) == 0 {
+		return nil, fmt.Errorf("Invalid Args")
+	}
+
+	hashedKey, err := c.hash.Process(accessKey)
+	if err != nil {
+		return nil, err
+	}
+
+	defer c.lockQueues(false, queueName)()
+
+	queue, found := c.db.Queues[queueName]
+	if !found {
+		return nil, fmt.Errorf("Not Found")
+	} else if queue.AccessKey != hashedKey {
+		return nil, fmt.Errorf("Unauthorized")
 	}
 
-	return fmt.Errorf("Not Found")
+	job := queue.lookup(uid)
+	if job == nil {
+		return nil, fmt.Errorf("Not Found")
+	} else if len(job.LeaseKey) == 0 || job.LeaseExpires < time.Now().Unix() {
+		return nil, fmt.Errorf("Invalid Lease")
+	} else if err = c.checkLease(job, leaseToken); err != nil {
+		return nil, err
+	}
+
+	job.LeaseExpires = time.Now().Unix() + c.leaseDuration(job, leaseSeconds)
+	job.LastUpdated = time.Now().Unix()
+	c.db.record(newJobEntry(queueName, job))
+	return &Lease{Token: leaseToken, Expires: job.LeaseExpires}, nil
 }
 
-// UpdateQueue sorts the given queue by name, removes any jobs that are timed out etc
+// UpdateQueue removes any jobs that are timed out etc, only the jobs due to be changed are checked and the queue is kept
+// in order as its jobs change so is not sorted
 func (c *QueryControl) UpdateQueue(queueName string) error {
 	if len(queueName) == 0 {
 		return fmt.Errorf("Invalid Args")
 	}
 
-	c.db.lock.Lock()
-	defer c.db.lock.Unlock()
+	defer c.lockQueues(true, queueName)()
 
 	queue, found := c.db.Queues[queueName]
 	if !found {
@@ -279,30 +516,48 @@ func (c *QueryControl) UpdateQueue(queueName string) error {
 	}
 
 	currentTime := time.Now().Unix()
-	indexToDelete := make([]int, 0)
+	queue.pruneIdempotencyKeys(currentTime)
+	toDelete := make([]*Job, 0)
+	deadLetter := make([]*Job, 0)
 
-	for i, job := range queue.Jobs {
+	for _, job := range queue.expiredJobs(currentTime) {
 		if (job.State == Complete || job.State == Failed) && job.LastUpdated < (currentTime-(job.KeepMinutes*60)) {
 			//remove complete/failed jobs that are outside the keep window
-			indexToDelete = append(indexToDelete, i)
+			toDelete = append(toDelete, job)
+		} else if job.State == Inprogress && job.LeaseExpires > 0 {
+			//return jobs to the queue once the lease on them expires, the worker holding it is presumed dead. A job with
+			//a limit on its attempts counts the expiry as a failed attempt, so is only re-queued if it has attempts left
+			if job.LeaseExpires < currentTime && job.MaxAttempts > 0 {
+				if c.failJob(queue, job, "Lease Expired", currentTime) {
+					deadLetter = append(deadLetter, job)
+				}
+			} else if job.LeaseExpires < currentTime {
+				job.State = Queued
+				job.LeaseKey = ""
+				job.LeaseExpires = 0
+				job.LastUpdated = currentTime
+				c.db.record(newJobEntry(queueName, job))
+				c.logger().Warn("Job Lease Expired", logger.F("queue", queueName), logger.F("uid", job.UID))
+			}
 		} else if job.State == Inprogress && (job.LastUpdated < (currentTime - (job.TimeoutMinutes * 60))) {
 			//mark as failed if no update within the timeout cut-off
-			job.State = Failed
-			job.LastUpdated = currentTime
+			if c.failJob(queue, job, "Timed Out", currentTime) {
+				deadLetter = append(deadLetter, job)
+			}
 		} else if job.State == Queued && (job.TimeoutTime > 0 && (currentTime > job.TimeoutTime)) {
 			//delete queued jobs that are timed out
-			indexToDelete = append(indexToDelete, i)
+			toDelete = append(toDelete, job)
 		}
 	}
 
-	for _, indexToDelete := range indexToDelete {
-		c.deleteJobAtIndex(queue, indexToDelete)
-		if queue.Size > 0 {
-			queue.Size--
-		}
+	for _, job := range toDelete {
+		c.deleteJob(queue, job)
+	}
+
+	for _, job := range deadLetter {
+		c.deadLetterJob(queue, job, job.RetryHistory[len(job.RetryHistory)-1].Error, currentTime)
 	}
 
-	c.sortQueue(queue)
 	return nil
 }
 
@@ -317,8 +572,7 @@ func (c *QueryControl) DeleteJob(uid, queueName, accessKey string) error {
 		return err
 	}
 
-	c.db.lock.Lock()
-	defer c.db.lock.Unlock()
+	defer c.lockQueues(false, queueName)()
 
 	queue, found := c.db.Queues[queueName]
 	if !found {
@@ -327,42 +581,107 @@ func (c *QueryControl) DeleteJob(uid, queueName, accessKey string) error {
 		return fmt.Errorf("Unauthorized")
 	}
 
-	index := -1
-	for i, job := range queue.Jobs {
-		if job.UID == uid {
-			index = i
-			break
-		}
+	job := queue.lookup(uid)
+	if job == nil {
+		return fmt.Errorf("Not Found")
 	}
 
-	// remove in linear time to preserve order
-	if index >= 0 {
-		copy(queue.Jobs[index:], queue.Jobs[index+1:])
-		queue.Jobs[len(queue.Jobs)-1] = nil
-		queue.Jobs = queue.Jobs[:len(queue.Jobs)-1]
-		queue.Size--
-		return nil
+	c.deleteJob(queue, job)
+	return nil
+}
+
+// deleteJob removes the given job from the queue, jobs blocked on it are resolved as if it failed - must handle Lock
+// outside of this function
+func (c *QueryControl) deleteJob(queue *Queue, job *Job) {
+	if c.removeJob(queue, job) {
+		c.resolveDependents(job.UID, Failed, time.Now().Unix())
+	}
+}
+
+// grantLease marks the given job as 'inprogress' under a new lease - must handle Lock outside of this function
+func (c *QueryControl) grantLease(queue *Queue, job *Job, leaseSeconds int64) (*Lease, error) {
+	token := uuid.New().String()
+	hashedToken, err := c.hash.Process(token)
+	if err != nil {
+		return nil, err
 	}
 
-	return fmt.Errorf("Not Found")
+	currentTime := time.Now().Unix()
+	job.State = Inprogress
+	job.Attempts++
+	job.LeaseKey = hashedToken
+	job.LeaseExpires = currentTime + c.leaseDuration(job, leaseSeconds)
+	job.LastUpdated = currentTime
+	c.db.record(newJobEntry(queue.Name, job))
+
+	return &Lease{Token: token, Expires: job.LeaseExpires}, nil
+}
+
+// failJob records a failed attempt at the given job, re-queueing it after its backoff delay if it has attempts remaining
+// or marking it as 'failed'. Returns true if the job has exhausted its attempts - must handle Lock outside of this function
+func (c *QueryControl) failJob(queue *Queue, job *Job, message string, currentTime int64) bool {
+	record := &RetryRecord{
+		Attempt: job.Attempts,
+		Failed:  currentTime,
+		Error:   message,
+	}
+
+	exhausted := job.Attempts >= job.MaxAttempts
+	if exhausted {
+		job.State = Failed
+	} else {
+		job.State = Queued
+		job.NotBefore = currentTime + job.Backoff.Delay(job.Attempts)
+		record.RetryAt = job.NotBefore
+	}
+
+	job.RetryHistory = append(job.RetryHistory, record)
+	job.LeaseKey = ""
+	job.LeaseExpires = 0
+	job.LastUpdated = currentTime
+	c.db.record(newJobEntry(queue.Name, job))
+	c.logger().Warn("Job Attempt Failed",
+		logger.F("queue", queue.Name),
+		logger.F("uid", job.UID),
+		logger.F("attempt", record.Attempt),
+		logger.F("reason", message),
+		logger.F("retry_at", record.RetryAt),
+	)
+
+	if exhausted {
+		c.resolveDependents(job.UID, Failed, currentTime)
+	}
+	return exhausted
 }
 
-// deleteJobAtIndex removes the given index from the job queue, cleans up memory during delete
-func (c *QueryControl) deleteJobAtIndex(queue *Queue, i int) {
-	queueLenMinus := len(queue.Jobs) - 1
-	if i < (queueLenMinus) {
-		copy(queue.Jobs[i:], queue.Jobs[i+1:])
+// checkLease ensures the given token matches the lease held on the job, a token is only required if the job is leased
+func (c *QueryControl) checkLease(job *Job, leaseToken string) error {
+	if len(job.LeaseKey) == 0 && len(leaseToken) == 0 {
+		return nil
+	} else if len(job.LeaseKey) == 0 || len(leaseToken) == 0 {
+		return fmt.Errorf("Invalid Lease")
 	}
-	queue.Jobs[queueLenMinus] = nil
-	queue.Jobs = queue.Jobs[:queueLenMinus]
-	queue.Size = len(queue.Jobs)
+
+	hashedToken, err := c.hash.Process(leaseToken)
+	if err != nil {
+		return err
+	} else if hashedToken != job.LeaseKey {
+		return fmt.Errorf("Invalid Lease")
+	}
+
+	return nil
 }
 
-//sortQueue orders the queue by priority, any other ordering should be maintained - must handle Lock outside of this function
-func (c *QueryControl) sortQueue(in *Queue) {
-	sort.Slice(in.Jobs, func(i, j int) bool {
-		return in.Jobs[i].Priority > in.Jobs[j].Priority
-	})
+// leaseDuration returns the number of seconds a lease on the given job should last for
+func (c *QueryControl) leaseDuration(job *Job, leaseSeconds int64) int64 {
+	switch {
+	case leaseSeconds > 0:
+		return leaseSeconds
+	case job.TimeoutMinutes > 0:
+		return job.TimeoutMinutes * 60
+	default:
+		return defaultLeaseSeconds
+	}
 }
 
 // validStatus checks the given status against the ValidStatus list, returns bool whether its valid
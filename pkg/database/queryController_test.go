@@ -0,0 +1,125 @@
+package database
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+// benchmarkQueueSize is the number of jobs the queue is filled with before each benchmark
+const benchmarkQueueSize int = 1000000
+
+// newBenchmarkController returns a controller over a queue filled with count queued jobs, indexed as they are once loaded
+// rather than added one by one so the queue is filled quickly
+func newBenchmarkController(b *testing.B, count int) *QueryControl {
+	b.Helper()
+	db, controller := newTestController(b, "queue")
+	queue := db.Queues["queue"]
+	queue.Jobs = make([]*Job, count)
+	for i := range queue.Jobs {
+		queue.Jobs[i] = &Job{UID: "prefilled-" + strconv.Itoa(i), State: Queued, Priority: i % 10, Created: 1}
+	}
+	db.buildIndexes()
+
+	// the jobs of a loaded queue are only found avalible once it is first checked, which is left out of the timings
+	if _, err := controller.GetNextJob("queue", testKey); err != nil {
+		b.Fatalf("GetNextJob: %s", err)
+	}
+	return controller
+}
+
+func BenchmarkAddJob(b *testing.B) {
+	controller := newBenchmarkController(b, benchmarkQueueSize)
+	jobs := make([]*Job, b.N)
+	for i := range jobs {
+		jobs[i] = &Job{UID: "added-" + strconv.Itoa(i), State: Queued, Priority: i % 10}
+	}
+
+	b.ResetTimer()
+	for _, job := range jobs {
+		if _, _, err := controller.AddJob(job, "queue", testKey); err != nil {
+			b.Fatalf("AddJob: %s", err)
+		}
+	}
+}
+
+func BenchmarkClaimNextJob(b *testing.B) {
+	controller := newBenchmarkController(b, benchmarkQueueSize+b.N)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if job, _, err := controller.ClaimNextJob("queue", testKey, 60); err != nil || job == nil {
+			b.Fatalf("ClaimNextJob: %v", err)
+		}
+	}
+}
+
+// expireLease claims the next job of the queue and moves the expiry of its lease into the past, returning the job
+func expireLease(t *testing.T, controller *QueryControl, queueName string) *Job {
+	t.Helper()
+	claimed, _, err := controller.ClaimNextJob(queueName, testKey, 60)
+	if err != nil || claimed == nil {
+		t.Fatalf("ClaimNextJob: %v", err)
+	}
+
+	queue := controller.db.Queues[queueName]
+	job := queue.lookup(claimed.UID)
+	job.LeaseExpires = time.Now().Unix() - 10
+	queue.index().update(queue.index().jobs[job.UID], job)
+	return job
+}
+
+func TestUpdateQueueLeaseExpiry(t *testing.T) {
+	tests := []struct {
+		maxAttempts int
+		states      []string
+	}{
+		{maxAttempts: 0, states: []string{Queued}},
+		{maxAttempts: 1, states: []string{Failed}},
+		{maxAttempts: 2, states: []string{Queued, Failed}},
+	}
+
+	for _, test := range tests {
+		_, controller := newTestController(t, "queue")
+		job := &Job{UID: "job", State: Queued, MaxAttempts: test.maxAttempts}
+		if _, _, err := controller.AddJob(job, "queue", testKey); err != nil {
+			t.Fatalf("AddJob: %s", err)
+		}
+
+		for attempt, state := range test.states {
+			job := expireLease(t, controller, "queue")
+			if err := controller.UpdateQueue("queue"); err != nil {
+				t.Fatalf("UpdateQueue: %s", err)
+			}
+			// an expiry is only recorded as a failed attempt if the attempts of the job are limited
+			failures := 0
+			if test.maxAttempts > 0 {
+				failures = attempt + 1
+			}
+			if job.State != state || len(job.RetryHistory) != failures {
+				t.Errorf("max attempts %d, lease expiry %d: state %s with %d failures, want %s with %d", test.maxAttempts, attempt+1, job.State, len(job.RetryHistory), state, failures)
+			}
+
+			// a re-queued job waits out its backoff before it can be claimed again
+			job.NotBefore = 0
+			controller.db.Queues["queue"].index().update(controller.db.Queues["queue"].index().jobs[job.UID], job)
+		}
+	}
+}
+
+func TestCreateQueueDeadLetterAccessKey(t *testing.T) {
+	_, controller := newTestController(t, "owned")
+	if err := controller.CreateQueue("foreign", "other-key", nil); err != nil {
+		t.Fatalf("CreateQueue: %s", err)
+	}
+
+	if err := controller.CreateQueue("queue", "other-key", &QueueOptions{DeadLetterQueue: "owned"}); err == nil {
+		t.Errorf("CreateQueue with the dead-letter queue of another access key succeeded")
+	}
+	if err := controller.CreateQueue("queue", testKey, &QueueOptions{DeadLetterQueue: "foreign"}); err == nil {
+		t.Errorf("CreateQueue with the dead-letter queue of another access key succeeded")
+	}
+	if err := controller.CreateQueue("queue", testKey, &QueueOptions{DeadLetterQueue: "owned"}); err != nil {
+		t.Errorf("CreateQueue with a dead-letter queue of the same access key: %s", err)
+	}
+}
@@ -1,9 +1,53 @@
 package database
 
+import "sync"
+
 // Queue represents a configured queue
 type Queue struct {
-	Jobs      []*Job `json:"jobs"`
-	AccessKey string `json:"access_key"`
-	Size      int    `json:"size"`
-	Name      string `json:"name"`
+	Jobs            []*Job                     `json:"jobs"`
+	AccessKey       string                     `json:"access_key"`
+	Size            int                        `json:"size"`
+	Name            string                     `json:"name"`
+	Schedules       map[string]*Schedule       `json:"schedules"`
+	IdempotencyKeys map[string]*IdempotencyKey `json:"idempotency_keys,omitempty"`
+	keyOrder        []*idempotencyRef
+	uniqueJobs      map[string]*Job
+	stats           *queueStats
+	indexed         *jobIndex
+	lock            *sync.Mutex
+	QueueOptions
+}
+
+// QueueOptions holds the optional settings a queue is created with
+type QueueOptions struct {
+	DeadLetterQueue          string   `json:"dead_letter_queue,omitempty"`
+	IdempotencyWindowSeconds int64    `json:"idempotency_window_seconds,omitempty"`
+	UniqueFields             []string `json:"unique_fields,omitempty"`
+	UniqueConflict           string   `json:"unique_conflict,omitempty"`
+	Durability               string   `json:"durability,omitempty"`
+}
+
+// copy returns a copy of the queue and its jobs that can be read once the lock of the queue is released
+func (q *Queue) copy() *Queue {
+	result := &Queue{
+		Jobs:         copyJobs(q.ordered()),
+		AccessKey:    q.AccessKey,
+		Size:         q.Size,
+		Name:         q.Name,
+		Schedules:    make(map[string]*Schedule, len(q.Schedules)),
+		QueueOptions: q.QueueOptions,
+	}
+
+	for name, schedule := range q.Schedules {
+		state := *schedule
+		result.Schedules[name] = &state
+	}
+	if q.IdempotencyKeys != nil {
+		result.IdempotencyKeys = make(map[string]*IdempotencyKey, len(q.IdempotencyKeys))
+		for key, record := range q.IdempotencyKeys {
+			state := *record
+			result.IdempotencyKeys[key] = &state
+		}
+	}
+	return result
 }
@@ -0,0 +1,75 @@
+package database
+
+import "math/rand"
+
+// BackoffFixed waits the same delay before every retry
+const BackoffFixed string = "fixed"
+
+// BackoffLinear increases the delay before each retry by the base delay
+const BackoffLinear string = "linear"
+
+// BackoffExponential doubles the delay before each retry
+const BackoffExponential string = "exponential"
+
+// maxBackoffShift caps the doubling of exponential backoff to avoid overflowing the delay
+const maxBackoffShift int = 32
+
+// BackoffPolicy defines how long a failed job waits before it is re-queued for another attempt
+type BackoffPolicy struct {
+	Type            string `json:"type"`
+	DelaySeconds    int64  `json:"delay_seconds"`
+	MaxDelaySeconds int64  `json:"max_delay_seconds"`
+	Jitter          bool   `json:"jitter"`
+}
+
+// RetryRecord represents a single failed attempt at processing a job
+type RetryRecord struct {
+	Attempt int    `json:"attempt"`
+	Failed  int64  `json:"failed"`
+	Error   string `json:"error,omitempty"`
+	RetryAt int64  `json:"retry_at,omitempty"`
+}
+
+// Valid returns whether the policy has a supported type and non-negative delays
+func (p *BackoffPolicy) Valid() bool {
+	if p.DelaySeconds < 0 || p.MaxDelaySeconds < 0 {
+		return false
+	}
+
+	switch {
+	case p.Type == BackoffFixed, p.Type == BackoffLinear, p.Type == BackoffExponential:
+		return true
+	default:
+		return false
+	}
+}
+
+// Delay returns the number of seconds to wait before the retry following the given attempt number (starting at 1),
+// with jitter enabled the delay is randomised between half and the full value
+func (p *BackoffPolicy) Delay(attempt int) int64 {
+	if p == nil || attempt < 1 {
+		return 0
+	}
+
+	delay := p.DelaySeconds
+	switch {
+	case p.Type == BackoffLinear:
+		delay = p.DelaySeconds * int64(attempt)
+	case p.Type == BackoffExponential:
+		shift := attempt - 1
+		if shift > maxBackoffShift {
+			shift = maxBackoffShift
+		}
+		delay = p.DelaySeconds << uint(shift)
+	}
+
+	if p.MaxDelaySeconds > 0 && delay > p.MaxDelaySeconds {
+		delay = p.MaxDelaySeconds
+	}
+
+	if p.Jitter && delay > 1 {
+		delay = delay/2 + rand.Int63n(delay/2+1)
+	}
+
+	return delay
+}
@@ -0,0 +1,323 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/MichaelWittgreffe/jobengine/pkg/cron"
+	"github.com/MichaelWittgreffe/jobengine/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// CatchUpSkip drops runs missed while the application was down, only runs due within the grace period are created
+const CatchUpSkip string = "skip"
+
+// CatchUpOnce creates a single job for any number of missed runs
+const CatchUpOnce string = "once"
+
+// CatchUpAll creates a job for every missed run, up to maxCatchUpRuns
+const CatchUpAll string = "all"
+
+// missedRunGraceSeconds is how late a run can be created before it is considered missed
+const missedRunGraceSeconds int64 = 60
+
+// maxCatchUpRuns limits the number of jobs created for missed runs of a single schedule
+const maxCatchUpRuns int = 100
+
+// Schedule represents a recurring job, created in its queue from the job template each time the cron expression activates
+type Schedule struct {
+	Name     string `json:"name"`
+	Cron     string `json:"cron"`
+	Timezone string `json:"timezone"`
+	CatchUp  string `json:"catch_up"`
+	Job      *Job   `json:"job"`
+	Created  int64  `json:"created"`
+	LastRun  int64  `json:"last_run"`
+	NextRun  int64  `json:"next_run"`
+}
+
+// nextRun returns the unix time of the first activation of the schedule after the given unix time, 0 if it never activates
+func (s *Schedule) nextRun(after int64) (int64, error) {
+	expression, location, err := s.parse()
+	if err != nil {
+		return 0, err
+	}
+	return activationAfter(expression, location, after), nil
+}
+
+// dueRuns returns the unix times of the runs due at the given time according to the catch-up policy, along with the
+// next run after them
+func (s *Schedule) dueRuns(currentTime int64) ([]int64, int64, error) {
+	expression, location, err := s.parse()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	missed := make([]int64, 0)
+	next := s.NextRun
+	for next > 0 && next <= currentTime && len(missed) < maxCatchUpRuns {
+		missed = append(missed, next)
+		next = activationAfter(expression, location, next)
+	}
+
+	if next > 0 && next <= currentTime {
+		// beyond the limit of missed runs, the remainder are dropped
+		next = activationAfter(expression, location, currentTime)
+	}
+
+	if len(missed) == 0 {
+		return missed, next, nil
+	}
+
+	switch {
+	case s.CatchUp == CatchUpAll:
+		return missed, next, nil
+	case s.CatchUp == CatchUpOnce:
+		return missed[len(missed)-1:], next, nil
+	default:
+		if latest := missed[len(missed)-1]; currentTime-latest <= missedRunGraceSeconds {
+			return []int64{latest}, next, nil
+		}
+		return missed[:0], next, nil
+	}
+}
+
+// parse returns the parsed cron expression and timezone of the schedule
+func (s *Schedule) parse() (*cron.Expression, *time.Location, error) {
+	expression, err := cron.Parse(s.Cron)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	location, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return expression, location, nil
+}
+
+// activationAfter returns the unix time of the first activation of the expression after the given unix time, 0 if it
+// never activates
+func activationAfter(expression *cron.Expression, location *time.Location, after int64) int64 {
+	next := expression.Next(time.Unix(after, 0).In(location))
+	if next.IsZero() {
+		return 0
+	}
+	return next.Unix()
+}
+
+// validCatchUp returns whether the given catch-up policy is supported
+func validCatchUp(policy string) bool {
+	switch {
+	case policy == CatchUpSkip, policy == CatchUpOnce, policy == CatchUpAll:
+		return true
+	default:
+		return false
+	}
+}
+
+// CreateSchedule adds the given schedule to the queue, the first run is calculated from the current time
+func (c *QueryControl) CreateSchedule(schedule *Schedule, queueName, accessKey string) error {
+	if schedule == nil || schedule.Job == nil || len(schedule.Name) == 0 || len(queueName) == 0 || len(accessKey) == 0 {
+		return fmt.Errorf("Invalid Args")
+	} else if schedule.Job.MaxAttempts < 0 || (schedule.Job.Backoff != nil && !schedule.Job.Backoff.Valid()) {
+		return fmt.Errorf("Invalid Args")
+	}
+
+	if len(schedule.Timezone) == 0 {
+		schedule.Timezone = "UTC"
+	}
+	if len(schedule.CatchUp) == 0 {
+		schedule.CatchUp = CatchUpSkip
+	} else if !validCatchUp(schedule.CatchUp) {
+		return fmt.Errorf("Invalid Args")
+	}
+
+	currentTime := time.Now().Unix()
+	nextRun, err := schedule.nextRun(currentTime)
+	if err != nil || nextRun == 0 {
+		return fmt.Errorf("Invalid Args")
+	}
+
+	hashedKey, err := c.hash.Process(accessKey)
+	if err != nil {
+		return err
+	}
+
+	defer c.lockQueues(false, queueName)()
+
+	queue, found := c.db.Queues[queueName]
+	if !found {
+		return fmt.Errorf("Not Found")
+	} else if queue.AccessKey != hashedKey {
+		return fmt.Errorf("Unauthorized")
+	} else if _, found = queue.Schedules[schedule.Name]; found {
+		return fmt.Errorf("Schedule Exists")
+	}
+
+	schedule.Created = currentTime
+	schedule.LastRun = 0
+	schedule.NextRun = nextRun
+
+	if queue.Schedules == nil {
+		queue.Schedules = make(map[string]*Schedule)
+	}
+	stored := *schedule
+	queue.Schedules[schedule.Name] = &stored
+	c.db.record(newScheduleEntry(queueName, &stored))
+	return nil
+}
+
+// GetSchedules returns the schedules of the given queue ordered by name
+func (c *QueryControl) GetSchedules(queueName, accessKey string) ([]*Schedule, error) {
+	if len(queueName) == 0 || len(accessKey) == 0 {
+		return nil, fmt.Errorf("Invalid Args")
+	}
+
+	hashedKey, err := c.hash.Process(accessKey)
+	if err != nil {
+		return nil, err
+	}
+
+	defer c.lockQueues(false, queueName)()
+
+	queue, found := c.db.Queues[queueName]
+	if !found {
+		return nil, fmt.Errorf("Not Found")
+	} else if queue.AccessKey != hashedKey {
+		return nil, fmt.Errorf("Unauthorized")
+	}
+
+	result := make([]*Schedule, 0, len(queue.Schedules))
+	for _, schedule := range queue.Schedules {
+		state := *schedule
+		result = append(result, &state)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+// DeleteSchedule removes the given schedule by name from the queue, jobs it has already created are kept
+func (c *QueryControl) DeleteSchedule(name, queueName, accessKey string) error {
+	if len(name) == 0 || len(queueName) == 0 || len(accessKey) == 0 {
+		return fmt.Errorf("Invalid Args")
+	}
+
+	hashedKey, err := c.hash.Process(accessKey)
+	if err != nil {
+		return err
+	}
+
+	defer c.lockQueues(false, queueName)()
+
+	queue, found := c.db.Queues[queueName]
+	if !found {
+		return fmt.Errorf("Not Found")
+	} else if queue.AccessKey != hashedKey {
+		return fmt.Errorf("Unauthorized")
+	} else if _, found = queue.Schedules[name]; !found {
+		return fmt.Errorf("Not Found")
+	}
+
+	delete(queue.Schedules, name)
+	c.db.record(&WALEntry{Op: WALDeleteSchedule, QueueName: queueName, Name: name})
+	return nil
+}
+
+// RunSchedules creates the jobs for every schedule due at the given unix time and advances them to their next run. The
+// jobs and schedule are recorded together, so a run is never created twice. Returns the number of jobs created and the
+// number of schedules advanced, a schedule is advanced even if the jobs of its runs are skipped
+func (c *QueryControl) RunSchedules(currentTime int64) (int, int, error) {
+	c.readLockDB()
+	names := make([]string, 0, len(c.db.Queues))
+	for name := range c.db.Queues {
+		names = append(names, name)
+	}
+	c.db.lock.RUnlock()
+
+	var lastErr error
+	created := 0
+	advanced := 0
+
+	for _, name := range names {
+		createdInQueue, advancedInQueue, err := c.runQueueSchedules(name, currentTime)
+		if err != nil {
+			lastErr = err
+		}
+		created += createdInQueue
+		advanced += advancedInQueue
+	}
+
+	return created, advanced, lastErr
+}
+
+// runQueueSchedules runs the schedules of the given queue due at the given unix time under the lock of the queue,
+// returning the number of jobs created and schedules advanced
+func (c *QueryControl) runQueueSchedules(queueName string, currentTime int64) (int, int, error) {
+	defer c.lockQueues(false, queueName)()
+
+	queue, found := c.db.Queues[queueName]
+	if !found {
+		return 0, 0, nil
+	}
+
+	var lastErr error
+	created := 0
+	advanced := 0
+
+	for _, schedule := range queue.Schedules {
+		if schedule.NextRun == 0 || schedule.NextRun > currentTime {
+			continue
+		}
+
+		runs, nextRun, err := schedule.dueRuns(currentTime)
+		if err != nil {
+			lastErr = fmt.Errorf("Error Running Schedule %s: %s", schedule.Name, err.Error())
+			continue
+		}
+
+		for range runs {
+			// a run is skipped if the job it would create matches the unique fields of an active job
+			job := newScheduledJob(schedule, currentTime)
+			if queue.uniqueConflict(job) == nil {
+				c.insertJob(queue, job, currentTime)
+				created++
+				c.logger().Info("Schedule Run", logger.F("queue", queue.Name), logger.F("schedule", schedule.Name), logger.F("uid", job.UID))
+			} else {
+				c.logger().Info("Schedule Run Skipped", logger.F("queue", queue.Name), logger.F("schedule", schedule.Name), logger.F("reason", "Job Exists"))
+			}
+		}
+
+		if len(runs) > 0 {
+			schedule.LastRun = runs[len(runs)-1]
+		}
+		schedule.NextRun = nextRun
+		c.db.record(newScheduleEntry(queue.Name, schedule))
+		advanced++
+	}
+
+	return created, advanced, lastErr
+}
+
+// newScheduledJob creates a new 'queued' job from the template of the given schedule
+func newScheduledJob(schedule *Schedule, currentTime int64) *Job {
+	template := *schedule.Job
+	return &Job{
+		Priority:       template.Priority,
+		KeepMinutes:    template.KeepMinutes,
+		TimeoutMinutes: template.TimeoutMinutes,
+		LastUpdated:    currentTime,
+		Created:        currentTime,
+		UID:            uuid.New().String(),
+		Content:        template.Content,
+		State:          Queued,
+		MaxAttempts:    template.MaxAttempts,
+		Backoff:        template.Backoff,
+		ScheduleName:   schedule.Name,
+	}
+}
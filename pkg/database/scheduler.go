@@ -0,0 +1,79 @@
+package database
+
+import (
+	"sync"
+	"time"
+
+	"github.com/MichaelWittgreffe/jobengine/pkg/logger"
+)
+
+// schedulerInterval is how often the scheduler checks for due schedules
+const schedulerInterval = 5 * time.Second
+
+// Scheduler presents an object to start creating the jobs of due schedules
+type Scheduler interface {
+	Start()
+	Stop()
+}
+
+// DBScheduler is an object responsible for creating the jobs of due schedules and requesting they are written
+type DBScheduler struct {
+	control  QueryController
+	monitor  DBMonitor
+	interval time.Duration
+	log      logger.Logger
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewDBScheduler is a constructor for the DBScheduler type
+func NewDBScheduler(controller QueryController, monitor DBMonitor, logger logger.Logger) Scheduler {
+	if controller == nil || monitor == nil {
+		return nil
+	}
+
+	return &DBScheduler{
+		control:  controller,
+		monitor:  monitor,
+		interval: schedulerInterval,
+		log:      logger,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start begins checking for due schedules, blocks current goroutine until Stop is called
+func (s *DBScheduler) Start() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.stop:
+			return
+		}
+
+		s.run(time.Now().Unix())
+	}
+}
+
+// run runs the schedules due at the given unix time, requesting a write if any were advanced even if no jobs were created
+func (s *DBScheduler) run(currentTime int64) {
+	_, advanced, err := s.control.RunSchedules(currentTime)
+	if err != nil {
+		s.log.Error("Error Running Schedules", logger.F("error", err))
+	}
+	if advanced > 0 {
+		s.monitor.Write()
+	}
+}
+
+// Stop ends the checks started by Start, waiting for a check in progress to finish
+func (s *DBScheduler) Stop() {
+	s.stopOnce.Do(func() { close(s.stop) })
+	<-s.done
+}
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/MichaelWittgreffe/jobengine/pkg/logger"
+	"github.com/MichaelWittgreffe/jobengine/pkg/metrics"
+)
+
+// countingMonitor is a DBMonitor counting the writes requested of it, without saving anything
+type countingMonitor struct {
+	writes int
+}
+
+func (m *countingMonitor) Write()                           { m.writes++ }
+func (m *countingMonitor) Commit(ctx context.Context) error { return nil }
+func (m *countingMonitor) Start()                           {}
+func (m *countingMonitor) Stop(ctx context.Context) error   { return nil }
+func (m *countingMonitor) Flush(ctx context.Context) error  { return nil }
+func (m *countingMonitor) Collect() []*metrics.Family       { return nil }
+
+func TestSchedulerWritesAdvancedSchedules(t *testing.T) {
+	_, controller := newTestController(t)
+	if err := controller.CreateQueue("queue", testKey, &QueueOptions{UniqueFields: []string{"id"}}); err != nil {
+		t.Fatalf("CreateQueue: %s", err)
+	}
+	content := map[string]interface{}{"id": "1"}
+	if _, _, err := controller.AddJob(&Job{UID: "active", State: Queued, Content: content}, "queue", testKey); err != nil {
+		t.Fatalf("AddJob: %s", err)
+	}
+	schedule := &Schedule{Name: "minutely", Cron: "* * * * *", Job: &Job{Content: content}}
+	if err := controller.CreateSchedule(schedule, "queue", testKey); err != nil {
+		t.Fatalf("CreateSchedule: %s", err)
+	}
+
+	monitor := new(countingMonitor)
+	scheduler := NewDBScheduler(controller, monitor, logger.NewLogger("text", "error")).(*DBScheduler)
+	currentTime := time.Now().Unix()
+
+	scheduler.run(currentTime)
+	if monitor.writes != 0 {
+		t.Fatalf("%d writes requested with no schedule due", monitor.writes)
+	}
+
+	// the run is skipped as its job matches the active job, but the schedule still moves on to its next run
+	controller.db.Queues["queue"].Schedules["minutely"].NextRun = currentTime - 60
+	scheduler.run(currentTime)
+	if monitor.writes != 1 {
+		t.Errorf("%d writes requested once the schedule was advanced, want 1", monitor.writes)
+	}
+	if nextRun := controller.db.Queues["queue"].Schedules["minutely"].NextRun; nextRun <= currentTime {
+		t.Errorf("schedule not advanced, next run %d", nextRun)
+	}
+	if size := controller.db.Queues["queue"].Size; size != 1 {
+		t.Errorf("queue holds %d jobs, want the skipped run not to add one", size)
+	}
+}
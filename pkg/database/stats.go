@@ -0,0 +1,315 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/MichaelWittgreffe/jobengine/pkg/metrics"
+)
+
+// durationBuckets are the upper bounds in seconds of the buckets jobs are counted into by how long they wait and run for
+var durationBuckets = []float64{1, 5, 15, 30, 60, 300, 900, 1800, 3600, 21600, 86400}
+
+// QueueStats represents the number of jobs at each status in a queue, with how long jobs wait to be processed and take
+// to process. Averages are kept from when the application started
+type QueueStats struct {
+	Name                     string         `json:"name,omitempty"`
+	Total                    int            `json:"total"`
+	Counts                   map[string]int `json:"counts"`
+	OldestQueuedSeconds      int64          `json:"oldest_queued_seconds"`
+	AverageWaitSeconds       float64        `json:"average_wait_seconds"`
+	AverageProcessingSeconds float64        `json:"average_processing_seconds"`
+	waitTotal                int64
+	waitCount                int64
+	processingTotal          int64
+	processingCount          int64
+}
+
+// StatsSummary represents the stats of every queue an access key is valid for, with the total across them
+type StatsSummary struct {
+	Queues []*QueueStats `json:"queues"`
+	Total  *QueueStats   `json:"total"`
+}
+
+// trackedJob records the status a job was last counted at and the time it was set
+type trackedJob struct {
+	state string
+	since int64
+}
+
+// queuedEntry records the time a job was set to 'queued', in the order jobs were queued
+type queuedEntry struct {
+	uid   string
+	since int64
+}
+
+// queueStats holds the counters of a queue, kept up to date as each change is recorded rather than counted on request
+type queueStats struct {
+	counts          map[string]int
+	jobs            map[string]*trackedJob
+	queued          []*queuedEntry
+	waitTotal       int64
+	waitCount       int64
+	processingTotal int64
+	processingCount int64
+	enqueued        int64
+	dequeued        int64
+	completed       int64
+	failed          int64
+	waitTimes       *metrics.Histogram
+	runTimes        *metrics.Histogram
+}
+
+// newQueueStats is a constructor for queueStats
+func newQueueStats() *queueStats {
+	return &queueStats{
+		counts:    make(map[string]int),
+		jobs:      make(map[string]*trackedJob),
+		queued:    make([]*queuedEntry, 0),
+		waitTimes: metrics.NewHistogram(durationBuckets),
+		runTimes:  metrics.NewHistogram(durationBuckets),
+	}
+}
+
+// jobStats returns the counters of the queue, created if the queue does not have any yet
+func (q *Queue) jobStats() *queueStats {
+	if q.stats == nil {
+		q.stats = newQueueStats()
+	}
+	return q.stats
+}
+
+// trackStats updates the counters of the queue the given entry changes - must handle Lock outside of this function
+func (db *DBFile) trackStats(entry *WALEntry) {
+	queue, found := db.Queues[entry.QueueName]
+	if !found {
+		return
+	}
+
+	switch entry.Op {
+	case WALPutJob:
+		queue.jobStats().update(entry.Job.UID, entry.Job.State, entry.Job.LastUpdated)
+	case WALDeleteJob:
+		queue.jobStats().remove(entry.UID)
+	}
+}
+
+// buildStats counts the jobs held by the queue once it is loaded, the order jobs were queued in is taken from the time
+// they were last updated
+func (q *Queue) buildStats() {
+	q.stats = newQueueStats()
+	for _, job := range q.Jobs {
+		q.stats.update(job.UID, job.State, job.LastUpdated)
+	}
+	sort.SliceStable(q.stats.queued, func(i, j int) bool {
+		return q.stats.queued[i].since < q.stats.queued[j].since
+	})
+
+	// loaded jobs were counted as they were first added, not again on every start
+	q.stats.enqueued = 0
+	q.stats.dequeued = 0
+	q.stats.completed = 0
+	q.stats.failed = 0
+}
+
+// update counts the job at the given status from the given time, recording the time it waited or was processed for if
+// it has left 'queued' or 'inprogress'
+func (s *queueStats) update(uid, state string, at int64) {
+	job, found := s.jobs[uid]
+	if found && job.state == state {
+		return
+	}
+
+	if found {
+		s.counts[job.state]--
+		if job.state == Queued && state == Inprogress && at >= job.since {
+			s.waitTotal += at - job.since
+			s.waitCount++
+			s.waitTimes.Observe(float64(at - job.since))
+		} else if job.state == Inprogress && at >= job.since {
+			s.processingTotal += at - job.since
+			s.processingCount++
+			s.runTimes.Observe(float64(at - job.since))
+		}
+	} else {
+		job = new(trackedJob)
+		s.jobs[uid] = job
+		s.enqueued++
+	}
+
+	switch {
+	case state == Inprogress:
+		s.dequeued++
+	case state == Complete:
+		s.completed++
+	case state == Failed:
+		s.failed++
+	}
+
+	job.state = state
+	job.since = at
+	s.counts[state]++
+
+	if state == Queued {
+		s.queued = append(s.queued, &queuedEntry{uid: uid, since: at})
+		s.compact()
+	}
+}
+
+// remove stops counting the job once it is removed from the queue
+func (s *queueStats) remove(uid string) {
+	if job, found := s.jobs[uid]; found {
+		s.counts[job.state]--
+		delete(s.jobs, uid)
+	}
+}
+
+// current returns whether the given entry is for a job that is still 'queued' since that time
+func (s *queueStats) current(entry *queuedEntry) bool {
+	job, found := s.jobs[entry.uid]
+	return found && job.state == Queued && job.since == entry.since
+}
+
+// compact drops the entries for jobs no longer 'queued' once they outnumber the jobs that are, entries are otherwise only
+// dropped from the head as the oldest is looked up
+func (s *queueStats) compact() {
+	if len(s.queued) <= 2*s.counts[Queued]+64 {
+		return
+	}
+
+	kept := s.queued[:0]
+	for _, entry := range s.queued {
+		if s.current(entry) {
+			kept = append(kept, entry)
+		}
+	}
+	for i := len(kept); i < len(s.queued); i++ {
+		s.queued[i] = nil
+	}
+	s.queued = kept
+}
+
+// oldestQueued returns the time the longest waiting 'queued' job was queued, 0 if none are queued
+func (s *queueStats) oldestQueued() int64 {
+	head := 0
+	for head < len(s.queued) && !s.current(s.queued[head]) {
+		s.queued[head] = nil
+		head++
+	}
+	s.queued = s.queued[head:]
+
+	if len(s.queued) == 0 {
+		return 0
+	}
+	return s.queued[0].since
+}
+
+// snapshot returns the stats of the queue at the given time
+func (s *queueStats) snapshot(name string, currentTime int64) *QueueStats {
+	result := &QueueStats{
+		Name:            name,
+		Counts:          make(map[string]int),
+		waitTotal:       s.waitTotal,
+		waitCount:       s.waitCount,
+		processingTotal: s.processingTotal,
+		processingCount: s.processingCount,
+	}
+
+	for _, state := range []string{Queued, Inprogress, Complete, Failed, Blocked, DeadLettered} {
+		result.Counts[state] = s.counts[state]
+		result.Total += s.counts[state]
+	}
+
+	if oldest := s.oldestQueued(); oldest > 0 && currentTime > oldest {
+		result.OldestQueuedSeconds = currentTime - oldest
+	}
+	result.average()
+	return result
+}
+
+// add includes the given stats in the totals of these stats
+func (r *QueueStats) add(other *QueueStats) {
+	for state, count := range other.Counts {
+		r.Counts[state] += count
+	}
+	r.Total += other.Total
+	if other.OldestQueuedSeconds > r.OldestQueuedSeconds {
+		r.OldestQueuedSeconds = other.OldestQueuedSeconds
+	}
+	r.waitTotal += other.waitTotal
+	r.waitCount += other.waitCount
+	r.processingTotal += other.processingTotal
+	r.processingCount += other.processingCount
+	r.average()
+}
+
+// average sets the average times from the totals
+func (r *QueueStats) average() {
+	if r.waitCount > 0 {
+		r.AverageWaitSeconds = float64(r.waitTotal) / float64(r.waitCount)
+	}
+	if r.processingCount > 0 {
+		r.AverageProcessingSeconds = float64(r.processingTotal) / float64(r.processingCount)
+	}
+}
+
+// GetQueueStats returns the stats of the given queue
+func (c *QueryControl) GetQueueStats(queueName, accessKey string) (*QueueStats, error) {
+	if len(queueName) == 0 || len(accessKey) == 0 {
+		return nil, fmt.Errorf("Invalid Args")
+	}
+
+	hashedKey, err := c.hash.Process(accessKey)
+	if err != nil {
+		return nil, err
+	}
+
+	defer c.lockQueues(false, queueName)()
+
+	queue, found := c.db.Queues[queueName]
+	if !found {
+		return nil, fmt.Errorf("Not Found")
+	} else if queue.AccessKey != hashedKey {
+		return nil, fmt.Errorf("Unauthorized")
+	}
+
+	return queue.jobStats().snapshot(queue.Name, time.Now().Unix()), nil
+}
+
+// GetAllStats returns the stats of every queue the access key is valid for ordered by name, with the total across them
+func (c *QueryControl) GetAllStats(accessKey string) (*StatsSummary, error) {
+	if len(accessKey) == 0 {
+		return nil, fmt.Errorf("Invalid Args")
+	}
+
+	hashedKey, err := c.hash.Process(accessKey)
+	if err != nil {
+		return nil, err
+	}
+
+	c.readLockDB()
+	defer c.db.lock.RUnlock()
+
+	currentTime := time.Now().Unix()
+	summary := &StatsSummary{
+		Queues: make([]*QueueStats, 0),
+		Total:  &QueueStats{Counts: make(map[string]int)},
+	}
+
+	for _, queue := range c.db.Queues {
+		if queue.AccessKey != hashedKey {
+			continue
+		}
+		queue.lock.Lock()
+		stats := queue.jobStats().snapshot(queue.Name, currentTime)
+		queue.lock.Unlock()
+		summary.Queues = append(summary.Queues, stats)
+		summary.Total.add(stats)
+	}
+
+	sort.Slice(summary.Queues, func(i, j int) bool {
+		return summary.Queues[i].Name < summary.Queues[j].Name
+	})
+	return summary, nil
+}
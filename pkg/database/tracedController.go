@@ -0,0 +1,343 @@
+package database
+
+import (
+	"context"
+
+	"github.com/MichaelWittgreffe/jobengine/pkg/metrics"
+	"github.com/MichaelWittgreffe/jobengine/pkg/tracing"
+)
+
+// tracedController wraps a QueryController, recording a span for each query made as part of a traced request
+type tracedController struct {
+	next QueryController
+	ctx  context.Context
+}
+
+// NewTracedQueryController is a constructor for a QueryController recording a span for each query to the given
+// controller, queries are only traced when given a context holding a span through WithContext
+func NewTracedQueryController(controller QueryController) QueryController {
+	if controller == nil {
+		return nil
+	}
+
+	return &tracedController{
+		next: controller,
+		ctx:  context.Background(),
+	}
+}
+
+// WithContext returns a copy of the controller recording spans as children of the span in ctx
+func (t *tracedController) WithContext(ctx context.Context) QueryController {
+	return &tracedController{
+		next: t.next,
+		ctx:  ctx,
+	}
+}
+
+// CreateQueue calls the wrapped controller within a span
+func (t *tracedController) CreateQueue(name, accessKey string, options *QueueOptions) error {
+	ctx, span := tracing.Start(t.ctx, "QueryController.CreateQueue")
+	span.SetAttribute("queue.name", name)
+	defer span.End()
+
+	err := t.next.WithContext(ctx).CreateQueue(name, accessKey, options)
+	span.SetError(err)
+	return err
+}
+
+// GetQueue calls the wrapped controller within a span
+func (t *tracedController) GetQueue(name, accessKey string) (*Queue, error) {
+	ctx, span := tracing.Start(t.ctx, "QueryController.GetQueue")
+	span.SetAttribute("queue.name", name)
+	defer span.End()
+
+	result, err := t.next.WithContext(ctx).GetQueue(name, accessKey)
+	span.SetError(err)
+	return result, err
+}
+
+// UpdateQueue calls the wrapped controller within a span
+func (t *tracedController) UpdateQueue(queueName string) error {
+	ctx, span := tracing.Start(t.ctx, "QueryController.UpdateQueue")
+	span.SetAttribute("queue.name", queueName)
+	defer span.End()
+
+	err := t.next.WithContext(ctx).UpdateQueue(queueName)
+	span.SetError(err)
+	return err
+}
+
+// DeleteQueue calls the wrapped controller within a span
+func (t *tracedController) DeleteQueue(name, accessKey string) error {
+	ctx, span := tracing.Start(t.ctx, "QueryController.DeleteQueue")
+	span.SetAttribute("queue.name", name)
+	defer span.End()
+
+	err := t.next.WithContext(ctx).DeleteQueue(name, accessKey)
+	span.SetError(err)
+	return err
+}
+
+// AddJob calls the wrapped controller within a span
+func (t *tracedController) AddJob(job *Job, queueName, accessKey string) (*Job, bool, error) {
+	ctx, span := tracing.Start(t.ctx, "QueryController.AddJob")
+	span.SetAttribute("queue.name", queueName)
+	defer span.End()
+
+	result, added, err := t.next.WithContext(ctx).AddJob(job, queueName, accessKey)
+	span.SetError(err)
+	return result, added, err
+}
+
+// AddJobs calls the wrapped controller within a span
+func (t *tracedController) AddJobs(jobs []*BulkJob, accessKey string, atomic bool) ([]*BulkResult, error) {
+	ctx, span := tracing.Start(t.ctx, "QueryController.AddJobs")
+	defer span.End()
+
+	result, err := t.next.WithContext(ctx).AddJobs(jobs, accessKey, atomic)
+	span.SetError(err)
+	return result, err
+}
+
+// ApplyJobOperation calls the wrapped controller within a span
+func (t *tracedController) ApplyJobOperation(operation *JobOperation, queueName, accessKey string, dryRun bool) (int, error) {
+	ctx, span := tracing.Start(t.ctx, "QueryController.ApplyJobOperation")
+	span.SetAttribute("queue.name", queueName)
+	defer span.End()
+
+	result, err := t.next.WithContext(ctx).ApplyJobOperation(operation, queueName, accessKey, dryRun)
+	span.SetError(err)
+	return result, err
+}
+
+// GetJob calls the wrapped controller within a span
+func (t *tracedController) GetJob(uid, queueName, accessKey string) (*Job, error) {
+	ctx, span := tracing.Start(t.ctx, "QueryController.GetJob")
+	span.SetAttribute("queue.name", queueName)
+	defer span.End()
+
+	result, err := t.next.WithContext(ctx).GetJob(uid, queueName, accessKey)
+	span.SetError(err)
+	return result, err
+}
+
+// GetNextJob calls the wrapped controller within a span
+func (t *tracedController) GetNextJob(queueName, accessKey string) (*Job, error) {
+	ctx, span := tracing.Start(t.ctx, "QueryController.GetNextJob")
+	span.SetAttribute("queue.name", queueName)
+	defer span.End()
+
+	result, err := t.next.WithContext(ctx).GetNextJob(queueName, accessKey)
+	span.SetError(err)
+	return result, err
+}
+
+// WaitForJob calls the wrapped controller without a span
+func (t *tracedController) WaitForJob(queueName string) <-chan struct{} {
+	return t.next.WaitForJob(queueName)
+}
+
+// Durability calls the wrapped controller without a span
+func (t *tracedController) Durability(queueName string) string {
+	return t.next.Durability(queueName)
+}
+
+// ClaimNextJob calls the wrapped controller within a span
+func (t *tracedController) ClaimNextJob(queueName, accessKey string, leaseSeconds int64) (*Job, *Lease, error) {
+	ctx, span := tracing.Start(t.ctx, "QueryController.ClaimNextJob")
+	span.SetAttribute("queue.name", queueName)
+	defer span.End()
+
+	result, lease, err := t.next.WithContext(ctx).ClaimNextJob(queueName, accessKey, leaseSeconds)
+	span.SetError(err)
+	return result, lease, err
+}
+
+// ClaimNextJobs calls the wrapped controller within a span
+func (t *tracedController) ClaimNextJobs(queueName, accessKey string, count int, leaseSeconds int64) ([]*Job, []*Lease, error) {
+	ctx, span := tracing.Start(t.ctx, "QueryController.ClaimNextJobs")
+	span.SetAttribute("queue.name", queueName)
+	defer span.End()
+
+	result, leases, err := t.next.WithContext(ctx).ClaimNextJobs(queueName, accessKey, count, leaseSeconds)
+	span.SetError(err)
+	return result, leases, err
+}
+
+// GetAllJobs calls the wrapped controller within a span
+func (t *tracedController) GetAllJobs(queueName, accessKey string) ([]*Job, error) {
+	ctx, span := tracing.Start(t.ctx, "QueryController.GetAllJobs")
+	span.SetAttribute("queue.name", queueName)
+	defer span.End()
+
+	result, err := t.next.WithContext(ctx).GetAllJobs(queueName, accessKey)
+	span.SetError(err)
+	return result, err
+}
+
+// ListJobs calls the wrapped controller within a span
+func (t *tracedController) ListJobs(query *JobQuery, queueName, accessKey string) (*JobPage, error) {
+	ctx, span := tracing.Start(t.ctx, "QueryController.ListJobs")
+	span.SetAttribute("queue.name", queueName)
+	defer span.End()
+
+	result, err := t.next.WithContext(ctx).ListJobs(query, queueName, accessKey)
+	span.SetError(err)
+	return result, err
+}
+
+// GetQueueStats calls the wrapped controller within a span
+func (t *tracedController) GetQueueStats(queueName, accessKey string) (*QueueStats, error) {
+	ctx, span := tracing.Start(t.ctx, "QueryController.GetQueueStats")
+	span.SetAttribute("queue.name", queueName)
+	defer span.End()
+
+	result, err := t.next.WithContext(ctx).GetQueueStats(queueName, accessKey)
+	span.SetError(err)
+	return result, err
+}
+
+// GetAllStats calls the wrapped controller within a span
+func (t *tracedController) GetAllStats(accessKey string) (*StatsSummary, error) {
+	ctx, span := tracing.Start(t.ctx, "QueryController.GetAllStats")
+	defer span.End()
+
+	result, err := t.next.WithContext(ctx).GetAllStats(accessKey)
+	span.SetError(err)
+	return result, err
+}
+
+// Collect calls the wrapped controller without a span
+func (t *tracedController) Collect() []*metrics.Family {
+	return t.next.Collect()
+}
+
+// UpdateJobStatus calls the wrapped controller within a span
+func (t *tracedController) UpdateJobStatus(uid, newStatus, leaseToken, message, queueName, accessKey string) error {
+	ctx, span := tracing.Start(t.ctx, "QueryController.UpdateJobStatus")
+	span.SetAttribute("queue.name", queueName)
+	defer span.End()
+
+	err := t.next.WithContext(ctx).UpdateJobStatus(uid, newStatus, leaseToken, message, queueName, accessKey)
+	span.SetError(err)
+	return err
+}
+
+// ExtendLease calls the wrapped controller within a span
+func (t *tracedController) ExtendLease(uid, leaseToken string, leaseSeconds int64, queueName, accessKey string) (*Lease, error) {
+	ctx, span := tracing.Start(t.ctx, "QueryController.ExtendLease")
+	span.SetAttribute("queue.name", queueName)
+	defer span.End()
+
+	result, err := t.next.WithContext(ctx).ExtendLease(uid, leaseToken, leaseSeconds, queueName, accessKey)
+	span.SetError(err)
+	return result, err
+}
+
+// DeleteJob calls the wrapped controller within a span
+func (t *tracedController) DeleteJob(uid, queueName, accessKey string) error {
+	ctx, span := tracing.Start(t.ctx, "QueryController.DeleteJob")
+	span.SetAttribute("queue.name", queueName)
+	defer span.End()
+
+	err := t.next.WithContext(ctx).DeleteJob(uid, queueName, accessKey)
+	span.SetError(err)
+	return err
+}
+
+// RejectJob calls the wrapped controller within a span
+func (t *tracedController) RejectJob(uid, leaseToken, reason, queueName, accessKey string) error {
+	ctx, span := tracing.Start(t.ctx, "QueryController.RejectJob")
+	span.SetAttribute("queue.name", queueName)
+	defer span.End()
+
+	err := t.next.WithContext(ctx).RejectJob(uid, leaseToken, reason, queueName, accessKey)
+	span.SetError(err)
+	return err
+}
+
+// GetDeadLetterJobs calls the wrapped controller within a span
+func (t *tracedController) GetDeadLetterJobs(queueName, accessKey string) ([]*Job, error) {
+	ctx, span := tracing.Start(t.ctx, "QueryController.GetDeadLetterJobs")
+	span.SetAttribute("queue.name", queueName)
+	defer span.End()
+
+	result, err := t.next.WithContext(ctx).GetDeadLetterJobs(queueName, accessKey)
+	span.SetError(err)
+	return result, err
+}
+
+// RedriveJobs calls the wrapped controller within a span
+func (t *tracedController) RedriveJobs(uids []string, queueName, accessKey string) (int, error) {
+	ctx, span := tracing.Start(t.ctx, "QueryController.RedriveJobs")
+	span.SetAttribute("queue.name", queueName)
+	defer span.End()
+
+	result, err := t.next.WithContext(ctx).RedriveJobs(uids, queueName, accessKey)
+	span.SetError(err)
+	return result, err
+}
+
+// CreateSchedule calls the wrapped controller within a span
+func (t *tracedController) CreateSchedule(schedule *Schedule, queueName, accessKey string) error {
+	ctx, span := tracing.Start(t.ctx, "QueryController.CreateSchedule")
+	span.SetAttribute("queue.name", queueName)
+	defer span.End()
+
+	err := t.next.WithContext(ctx).CreateSchedule(schedule, queueName, accessKey)
+	span.SetError(err)
+	return err
+}
+
+// GetSchedules calls the wrapped controller within a span
+func (t *tracedController) GetSchedules(queueName, accessKey string) ([]*Schedule, error) {
+	ctx, span := tracing.Start(t.ctx, "QueryController.GetSchedules")
+	span.SetAttribute("queue.name", queueName)
+	defer span.End()
+
+	result, err := t.next.WithContext(ctx).GetSchedules(queueName, accessKey)
+	span.SetError(err)
+	return result, err
+}
+
+// DeleteSchedule calls the wrapped controller within a span
+func (t *tracedController) DeleteSchedule(name, queueName, accessKey string) error {
+	ctx, span := tracing.Start(t.ctx, "QueryController.DeleteSchedule")
+	span.SetAttribute("queue.name", queueName)
+	defer span.End()
+
+	err := t.next.WithContext(ctx).DeleteSchedule(name, queueName, accessKey)
+	span.SetError(err)
+	return err
+}
+
+// RunSchedules calls the wrapped controller within a span
+func (t *tracedController) RunSchedules(currentTime int64) (int, int, error) {
+	ctx, span := tracing.Start(t.ctx, "QueryController.RunSchedules")
+	defer span.End()
+
+	created, advanced, err := t.next.WithContext(ctx).RunSchedules(currentTime)
+	span.SetError(err)
+	return created, advanced, err
+}
+
+// AddWorkflow calls the wrapped controller within a span
+func (t *tracedController) AddWorkflow(workflow *Workflow, accessKey string) (*Workflow, error) {
+	ctx, span := tracing.Start(t.ctx, "QueryController.AddWorkflow")
+	defer span.End()
+
+	result, err := t.next.WithContext(ctx).AddWorkflow(workflow, accessKey)
+	span.SetError(err)
+	return result, err
+}
+
+// GetWorkflow calls the wrapped controller within a span
+func (t *tracedController) GetWorkflow(workflowID, queueName, accessKey string) (*WorkflowStatus, error) {
+	ctx, span := tracing.Start(t.ctx, "QueryController.GetWorkflow")
+	span.SetAttribute("queue.name", queueName)
+	defer span.End()
+
+	result, err := t.next.WithContext(ctx).GetWorkflow(workflowID, queueName, accessKey)
+	span.SetError(err)
+	return result, err
+}
@@ -0,0 +1,53 @@
+package database
+
+import (
+	"context"
+
+	"github.com/MichaelWittgreffe/jobengine/pkg/tracing"
+)
+
+// tracedFileHandler wraps a DBFileHandler, recording a span for each load and save of the database
+type tracedFileHandler struct {
+	next   DBFileHandler
+	tracer *tracing.Tracer
+}
+
+// NewTracedDBFileHandler is a constructor for a DBFileHandler recording a span with the given tracer for each load and
+// save made through the given handler
+func NewTracedDBFileHandler(handler DBFileHandler, tracer *tracing.Tracer) DBFileHandler {
+	if handler == nil || tracer == nil {
+		return nil
+	}
+
+	return &tracedFileHandler{
+		next:   handler,
+		tracer: tracer,
+	}
+}
+
+// SaveToFile saves the dbFile through the wrapped handler within a span
+func (h *tracedFileHandler) SaveToFile(dbFile *DBFile, filePath string) error {
+	_, span := h.tracer.Start(context.Background(), "DBFileHandler.SaveToFile", tracing.KindInternal)
+	span.SetAttribute("db.path", filePath)
+	defer span.End()
+
+	err := h.next.SaveToFile(dbFile, filePath)
+	span.SetError(err)
+	return err
+}
+
+// LoadFromFile loads the dbFile through the wrapped handler within a span
+func (h *tracedFileHandler) LoadFromFile(dbFile *DBFile, filePath string) error {
+	_, span := h.tracer.Start(context.Background(), "DBFileHandler.LoadFromFile", tracing.KindInternal)
+	span.SetAttribute("db.path", filePath)
+	defer span.End()
+
+	err := h.next.LoadFromFile(dbFile, filePath)
+	span.SetError(err)
+	return err
+}
+
+// FileSize returns the size of the database through the wrapped handler
+func (h *tracedFileHandler) FileSize(filePath string) (int64, error) {
+	return h.next.FileSize(filePath)
+}
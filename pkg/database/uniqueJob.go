@@ -0,0 +1,132 @@
+package database
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// UniqueReject rejects a job that matches the unique fields of an active job in the queue, the default
+const UniqueReject string = "reject"
+
+// UniqueMerge keeps the active job that matches the unique fields of a new job, raising its priority to the higher of
+// the two, rather than adding the new job
+const UniqueMerge string = "merge"
+
+// validUniqueOptions returns whether the given unique fields and conflict mode are supported
+func validUniqueOptions(fields []string, conflict string) bool {
+	if len(conflict) > 0 && conflict != UniqueReject && conflict != UniqueMerge {
+		return false
+	}
+
+	for _, field := range fields {
+		if !validFieldPath(field) {
+			return false
+		}
+	}
+	return true
+}
+
+// validFieldPath returns whether the given path into the job content is valid, parts are separated by '.' with an
+// optional '$.' prefix
+func validFieldPath(field string) bool {
+	for _, part := range strings.Split(strings.TrimPrefix(field, "$."), ".") {
+		if len(part) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// uniqueActive returns whether the job counts towards the unique fields of its queue, jobs that have finished do not
+func uniqueActive(job *Job) bool {
+	return job.State == Queued || job.State == Inprogress || job.State == Blocked
+}
+
+// lookupField returns the value at the given path within the job content
+func lookupField(content map[string]interface{}, field string) (interface{}, bool) {
+	var value interface{} = content
+	for _, part := range strings.Split(strings.TrimPrefix(field, "$."), ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = object[part]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// uniqueKey returns the values of the queues unique fields within the job content, false if the queue has no unique
+// fields or the job does not hold all of them
+func (q *Queue) uniqueKey(job *Job) (string, bool) {
+	if len(q.UniqueFields) == 0 {
+		return "", false
+	}
+
+	values := make([]interface{}, len(q.UniqueFields))
+	for i, field := range q.UniqueFields {
+		value, found := lookupField(job.Content, field)
+		if !found {
+			return "", false
+		}
+		values[i] = value
+	}
+
+	key, err := json.Marshal(values)
+	if err != nil {
+		return "", false
+	}
+	return string(key), true
+}
+
+// uniqueConflict returns the active job in the queue with the same unique field values as the given job, nil if none
+func (q *Queue) uniqueConflict(job *Job) *Job {
+	key, ok := q.uniqueKey(job)
+	if !ok {
+		return nil
+	}
+
+	if existing, found := q.uniqueJobs[key]; found && existing != job && uniqueActive(existing) {
+		return existing
+	}
+	return nil
+}
+
+// uniqueFree returns whether the job can be made active in the queue without matching the unique fields of an active
+// job, or of a job already made active by the same change as recorded in reserved. The values of the job are added to
+// reserved if it can
+func (q *Queue) uniqueFree(job *Job, reserved map[string]bool) bool {
+	key, ok := q.uniqueKey(job)
+	if !ok {
+		return true
+	} else if reserved[key] || q.uniqueConflict(job) != nil {
+		return false
+	}
+
+	reserved[key] = true
+	return true
+}
+
+// indexUnique records the given job against its unique field values, unless an active job already holds them. Entries
+// for jobs that have since finished are replaced as they are found
+func (q *Queue) indexUnique(job *Job) {
+	key, ok := q.uniqueKey(job)
+	if !ok || !uniqueActive(job) {
+		return
+	}
+
+	if q.uniqueJobs == nil {
+		q.uniqueJobs = make(map[string]*Job)
+	}
+	if existing, found := q.uniqueJobs[key]; !found || !uniqueActive(existing) {
+		q.uniqueJobs[key] = job
+	}
+}
+
+// unindexUnique removes the given job from the unique field index as it is removed from the queue
+func (q *Queue) unindexUnique(job *Job) {
+	if key, ok := q.uniqueKey(job); ok && q.uniqueJobs[key] == job {
+		delete(q.uniqueJobs, key)
+	}
+}
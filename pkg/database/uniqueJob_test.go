@@ -0,0 +1,132 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// newUniqueController returns a controller over queues 'queue' and 'target' with unique field 'id', 'queue' dead-letters
+// its jobs to 'dlq'
+func newUniqueController(t *testing.T) *QueryControl {
+	t.Helper()
+	_, controller := newTestController(t, "dlq")
+	options := []struct {
+		name    string
+		options *QueueOptions
+	}{
+		{name: "queue", options: &QueueOptions{UniqueFields: []string{"id"}, DeadLetterQueue: "dlq"}},
+		{name: "target", options: &QueueOptions{UniqueFields: []string{"id"}}},
+	}
+	for _, queue := range options {
+		if err := controller.CreateQueue(queue.name, testKey, queue.options); err != nil {
+			t.Fatalf("CreateQueue(%s): %s", queue.name, err)
+		}
+	}
+	return controller
+}
+
+// addUniqueJob adds a queued job with the given id to the queue, returning its UID
+func addUniqueJob(t *testing.T, controller *QueryControl, queueName, id string) string {
+	t.Helper()
+	job := &Job{UID: uuid.New().String(), State: Queued, Content: map[string]interface{}{"id": id}}
+	if _, _, err := controller.AddJob(job, queueName, testKey); err != nil {
+		t.Fatalf("AddJob: %s", err)
+	}
+	return job.UID
+}
+
+// setStatus updates the status of the job, failing the test if it cannot be
+func setStatus(t *testing.T, controller *QueryControl, queueName, uid, status string) {
+	t.Helper()
+	if err := controller.UpdateJobStatus(uid, status, "", "", queueName, testKey); err != nil {
+		t.Fatalf("UpdateJobStatus(%s): %s", status, err)
+	}
+}
+
+// activeJobs returns the number of active jobs in the queue with the given id
+func activeJobs(controller *QueryControl, queueName, id string) int {
+	count := 0
+	for _, job := range controller.db.Queues[queueName].Jobs {
+		if job.Content["id"] == id && uniqueActive(job) {
+			count++
+		}
+	}
+	return count
+}
+
+func TestUniqueRequeue(t *testing.T) {
+	controller := newUniqueController(t)
+	finished := addUniqueJob(t, controller, "queue", "1")
+	setStatus(t, controller, "queue", finished, Complete)
+	active := addUniqueJob(t, controller, "queue", "1")
+
+	requeue := &JobOperation{Op: OperationRequeue, Filter: &JobFilter{}}
+	if affected, err := controller.ApplyJobOperation(requeue, "queue", testKey, false); err != nil || affected != 0 {
+		t.Fatalf("requeue alongside an active job affected %d: %v", affected, err)
+	}
+
+	setStatus(t, controller, "queue", active, Complete)
+	if affected, err := controller.ApplyJobOperation(requeue, "queue", testKey, false); err != nil || affected != 1 {
+		t.Fatalf("requeue of two finished jobs affected %d, want 1: %v", affected, err)
+	}
+	if count := activeJobs(controller, "queue", "1"); count != 1 {
+		t.Errorf("%d active jobs with the same id", count)
+	}
+	if _, _, err := controller.AddJob(&Job{UID: uuid.New().String(), State: Queued, Content: map[string]interface{}{"id": "1"}}, "queue", testKey); err == nil || err.Error() != "Job Exists" {
+		t.Errorf("AddJob alongside the requeued job: %v, want Job Exists", err)
+	}
+}
+
+func TestUniqueRedrive(t *testing.T) {
+	controller := newUniqueController(t)
+	deadLettered := addUniqueJob(t, controller, "queue", "1")
+	setStatus(t, controller, "queue", deadLettered, Failed)
+	active := addUniqueJob(t, controller, "queue", "1")
+
+	if redriven, err := controller.RedriveJobs(nil, "queue", testKey); err != nil || redriven != 0 {
+		t.Fatalf("redrive alongside an active job redrove %d: %v", redriven, err)
+	}
+	if _, err := controller.RedriveJobs([]string{deadLettered}, "queue", testKey); err == nil || err.Error() != "Job Exists" {
+		t.Fatalf("redrive of the given job alongside an active job: %v, want Job Exists", err)
+	}
+
+	setStatus(t, controller, "queue", active, Complete)
+	if redriven, err := controller.RedriveJobs([]string{deadLettered}, "queue", testKey); err != nil || redriven != 1 {
+		t.Fatalf("redrive redrove %d, want 1: %v", redriven, err)
+	}
+	if _, _, err := controller.AddJob(&Job{UID: uuid.New().String(), State: Queued, Content: map[string]interface{}{"id": "1"}}, "queue", testKey); err == nil || err.Error() != "Job Exists" {
+		t.Errorf("AddJob alongside the redriven job: %v, want Job Exists", err)
+	}
+}
+
+func TestUniqueMove(t *testing.T) {
+	controller := newUniqueController(t)
+	addUniqueJob(t, controller, "queue", "1")
+	addUniqueJob(t, controller, "queue", "2")
+	addUniqueJob(t, controller, "target", "1")
+
+	move := &JobOperation{Op: OperationMove, Filter: &JobFilter{}, TargetQueue: "target"}
+	if affected, err := controller.ApplyJobOperation(move, "queue", testKey, false); err != nil || affected != 1 {
+		t.Fatalf("move affected %d, want 1: %v", affected, err)
+	}
+	if count := activeJobs(controller, "target", "1"); count != 1 {
+		t.Errorf("%d active jobs with the same id in the target queue", count)
+	}
+	if count := activeJobs(controller, "queue", "1"); count != 1 {
+		t.Errorf("conflicting job moved out of its queue")
+	}
+}
+
+func TestUniqueUpdateJobStatus(t *testing.T) {
+	controller := newUniqueController(t)
+	finished := addUniqueJob(t, controller, "queue", "1")
+	setStatus(t, controller, "queue", finished, Complete)
+	addUniqueJob(t, controller, "queue", "1")
+
+	for _, status := range []string{Queued, Inprogress} {
+		if err := controller.UpdateJobStatus(finished, status, "", "", "queue", testKey); err == nil || err.Error() != "Job Exists" {
+			t.Errorf("UpdateJobStatus(%s) alongside an active job: %v, want Job Exists", status, err)
+		}
+	}
+}
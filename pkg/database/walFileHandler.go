@@ -0,0 +1,227 @@
+package database
+
+import (
+	"encoding/binary"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/MichaelWittgreffe/jobengine/pkg/crypto"
+	"github.com/MichaelWittgreffe/jobengine/pkg/filesystem"
+)
+
+// defaultWALCompactAfter is the number of log entries written before the log is compacted into a new snapshot
+const defaultWALCompactAfter int = 1000
+
+// walRecordHeaderSize is the size of the length prefix written before each encrypted log record
+const walRecordHeaderSize int = 4
+
+// WALFileHandler handles a DBFile as a snapshot plus an append-only, encrypted write-ahead log of the mutations made
+// since. Each save appends the journal of the DBFile as one record, the log is compacted into the snapshot periodically
+type WALFileHandler struct {
+	encrypt      crypto.EncryptionHandler
+	data         DBDataHandler
+	file         filesystem.FileSystem
+	snapshot     *FSFileHandler
+	compactAfter int
+	logEntries   int
+	saving       sync.Mutex
+}
+
+// SaveToFile appends the changes made to dbFile since the last save to the log for filePath, applies lock. The database
+// is locked while the journal is taken, as changes hold it for reading while they record their entries this waits for
+// those in progress so none are split between saves. It is locked to compact the log while the snapshot is encoded
+func (h *WALFileHandler) SaveToFile(dbFile *DBFile, filePath string) error {
+	if dbFile == nil || len(filePath) == 0 {
+		return fmt.Errorf("Invalid Args")
+	}
+
+	h.saving.Lock()
+	defer h.saving.Unlock()
+
+	if exists, err := h.file.FileExists(filePath); !exists && err == nil {
+		return h.compact(dbFile, filePath)
+	} else if err != nil {
+		return fmt.Errorf("Error Checking DBFile Existence: %s", err.Error())
+	}
+
+	if h.logEntries >= h.compactAfter {
+		return h.compact(dbFile, filePath)
+	}
+
+	dbFile.lock.Lock()
+	journal := dbFile.takeJournal()
+	dbFile.lock.Unlock()
+	if len(journal) == 0 {
+		return nil
+	}
+
+	record, err := h.encodeRecord(journal)
+	if err != nil {
+		h.logEntries = h.compactAfter
+		return err
+	}
+
+	if err = h.file.AppendFile(walPath(filePath), record); err != nil {
+		// the journal is lost and the log may end in a torn record, so the next save must write a full snapshot
+		h.logEntries = h.compactAfter
+		return fmt.Errorf("Failed To Append Log: %s", err.Error())
+	}
+
+	logCreated := h.logEntries == 0
+	h.logEntries += len(journal)
+
+	if logCreated {
+		// the log has just been created, its directory entry must be durable too
+		if err = h.file.SyncDir(filepath.Dir(filePath)); err != nil {
+			return fmt.Errorf("Failed To Sync Log Directory: %s", err.Error())
+		}
+	}
+
+	if h.logEntries >= h.compactAfter {
+		return h.compact(dbFile, filePath)
+	}
+
+	return nil
+}
+
+// LoadFromFile loads the snapshot at filePath into dbFile and replays any log written since, applies lock
+func (h *WALFileHandler) LoadFromFile(dbFile *DBFile, filePath string) error {
+	if dbFile == nil || len(filePath) == 0 {
+		return fmt.Errorf("Invalid Args")
+	}
+
+	dbFile.lock.Lock()
+	defer dbFile.lock.Unlock()
+
+	if err := h.snapshot.readSnapshot(dbFile, filePath); err != nil {
+		return err
+	}
+
+	exists, err := h.file.FileExists(walPath(filePath))
+	if err != nil {
+		return fmt.Errorf("Error Checking Log Existence: %s", err.Error())
+	} else if !exists {
+		dbFile.buildIndexes()
+		return nil
+	}
+
+	log, err := h.file.ReadFile(walPath(filePath))
+	if err != nil {
+		return fmt.Errorf("Error Reading Log: %s", err.Error())
+	}
+
+	for len(log) >= walRecordHeaderSize {
+		recordSize := int(binary.BigEndian.Uint32(log[:walRecordHeaderSize]))
+		if len(log) < walRecordHeaderSize+recordSize {
+			// a torn write from a crash mid-append, the mutation was never acknowledged as saved
+			break
+		}
+
+		entries, err := h.decodeRecord(log[walRecordHeaderSize : walRecordHeaderSize+recordSize])
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			if err = dbFile.apply(entry); err != nil {
+				return fmt.Errorf("Error Replaying Log: %s", err.Error())
+			}
+		}
+
+		h.logEntries += len(entries)
+		log = log[walRecordHeaderSize+recordSize:]
+	}
+
+	if len(log) > 0 {
+		// records appended after the torn write would be read as part of it, so the next save must write a full snapshot
+		// replacing the log
+		h.logEntries = h.compactAfter
+	}
+
+	dbFile.takeJournal()
+	dbFile.buildIndexes()
+	return nil
+}
+
+// compact writes the full dbFile as a new snapshot and removes the log it replaces, locking the database while the
+// snapshot is encoded
+func (h *WALFileHandler) compact(dbFile *DBFile, filePath string) error {
+	dbFile.lock.Lock()
+	// the snapshot holds every change made so far, so the journal does not need appending
+	dbFile.takeJournal()
+	encodedData, err := h.snapshot.encodeSnapshot(dbFile)
+	dbFile.lock.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	if err = h.snapshot.writeSnapshot(encodedData, filePath); err != nil {
+		return err
+	}
+
+	// replaying a log over a snapshot that already holds its entries is harmless, so a failure here loses nothing
+	if exists, err := h.file.FileExists(walPath(filePath)); exists && err == nil {
+		if err = h.file.DeleteFile(walPath(filePath)); err != nil {
+			return fmt.Errorf("Error Deleting Compacted Log: %s", err.Error())
+		}
+	} else if err != nil {
+		return fmt.Errorf("Error Checking Log Existence: %s", err.Error())
+	}
+
+	h.logEntries = 0
+	return nil
+}
+
+// encodeRecord encodes and encrypts the given entries as a single length-prefixed log record
+func (h *WALFileHandler) encodeRecord(entries []*WALEntry) ([]byte, error) {
+	encodedData, err := h.data.Encode(entries)
+	if err != nil {
+		return nil, fmt.Errorf("Failed Encoding Log Entries: %s", err.Error())
+	}
+
+	encryptedData, err := h.encrypt.Encrypt(encodedData)
+	if err != nil {
+		return nil, fmt.Errorf("Failed Encrypting Log Entries: %s", err.Error())
+	}
+
+	record := make([]byte, walRecordHeaderSize+len(encryptedData))
+	binary.BigEndian.PutUint32(record[:walRecordHeaderSize], uint32(len(encryptedData)))
+	copy(record[walRecordHeaderSize:], encryptedData)
+	return record, nil
+}
+
+// decodeRecord decrypts and decodes the entries held in a single log record, without its length prefix
+func (h *WALFileHandler) decodeRecord(record []byte) ([]*WALEntry, error) {
+	decryptedData, err := h.encrypt.Decrypt(record)
+	if err != nil {
+		return nil, fmt.Errorf("Error Decrypting Log Record: %s", err.Error())
+	}
+
+	entries := make([]*WALEntry, 0)
+	if err = h.data.Decode(decryptedData, &entries); err != nil {
+		return nil, fmt.Errorf("Error Decoding Log Record: %s", err.Error())
+	}
+
+	return entries, nil
+}
+
+// FileSize returns the size in bytes of the database at filePath, the snapshot and the log together
+func (h *WALFileHandler) FileSize(filePath string) (int64, error) {
+	snapshotSize, err := h.file.FileSize(filePath)
+	if err != nil {
+		return 0, err
+	}
+
+	logSize, err := h.file.FileSize(walPath(filePath))
+	if err != nil {
+		return 0, err
+	}
+	return snapshotSize + logSize, nil
+}
+
+// walPath returns the path of the log file kept alongside the snapshot at filePath
+func walPath(filePath string) string {
+	return filePath + ".wal"
+}
@@ -0,0 +1,92 @@
+package database
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWALFileHandlerTornTail(t *testing.T) {
+	path := newTestPath(t)
+	db, controller := newTestController(t, "queue")
+	handler := newTestFileHandler(t, "wal", nil)
+	if err := handler.SaveToFile(db, path); err != nil {
+		t.Fatalf("SaveToFile: %s", err)
+	}
+	before := addTestJobs(t, controller, "queue", 1, 0)
+	if err := handler.SaveToFile(db, path); err != nil {
+		t.Fatalf("SaveToFile: %s", err)
+	}
+
+	// a crash part way through appending leaves a partial record at the end of the log
+	log, err := os.OpenFile(walPath(path), os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Write([]byte{0, 0, 1, 0, 'j', 'u', 'n', 'k'})
+	log.Close()
+
+	restarted := NewDBFile()
+	handler = newTestFileHandler(t, "wal", nil)
+	if err = handler.LoadFromFile(restarted, path); err != nil {
+		t.Fatalf("LoadFromFile after torn write: %s", err)
+	}
+	after := addTestJobs(t, NewQueryController(restarted, controller.hash, controller.log), "queue", 1, 0)
+	if err = handler.SaveToFile(restarted, path); err != nil {
+		t.Fatalf("SaveToFile after torn write: %s", err)
+	}
+
+	loaded := NewDBFile()
+	if err = newTestFileHandler(t, "wal", nil).LoadFromFile(loaded, path); err != nil {
+		t.Fatalf("LoadFromFile after save: %s", err)
+	}
+	for _, uid := range append(before, after...) {
+		if loaded.Queues["queue"].lookup(uid) == nil {
+			t.Errorf("job %s not loaded", uid)
+		}
+	}
+}
+
+func TestWALFileHandlerWaitsForChanges(t *testing.T) {
+	path := newTestPath(t)
+	db, controller := newTestController(t, "queue")
+	handler := newTestFileHandler(t, "wal", nil)
+	if err := handler.SaveToFile(db, path); err != nil {
+		t.Fatalf("SaveToFile: %s", err)
+	}
+
+	// a change recording more than one entry is saved in full or not at all, so a save waits for it to finish
+	release := controller.lockQueues(false, "queue")
+	queue := db.Queues["queue"]
+	first := &Job{UID: "first", State: Queued}
+	queue.appendJob(first)
+	db.record(newJobEntry("queue", first))
+
+	saved := make(chan error, 1)
+	go func() {
+		saved <- handler.SaveToFile(db, path)
+	}()
+	select {
+	case err := <-saved:
+		t.Fatalf("SaveToFile finished part way through a change: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	second := &Job{UID: "second", State: Queued}
+	queue.appendJob(second)
+	db.record(newJobEntry("queue", second))
+	release()
+	if err := <-saved; err != nil {
+		t.Fatalf("SaveToFile: %s", err)
+	}
+
+	loaded := NewDBFile()
+	if err := newTestFileHandler(t, "wal", nil).LoadFromFile(loaded, path); err != nil {
+		t.Fatalf("LoadFromFile: %s", err)
+	}
+	for _, uid := range []string{"first", "second"} {
+		if loaded.Queues["queue"].lookup(uid) == nil {
+			t.Errorf("job %s not saved", uid)
+		}
+	}
+}
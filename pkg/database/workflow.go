@@ -0,0 +1,210 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// Workflow represents a set of jobs submitted together across one or more queues, jobs within the workflow depend on each
+// other by their reference
+type Workflow struct {
+	ID   string         `json:"workflow_id"`
+	Jobs []*WorkflowJob `json:"jobs"`
+}
+
+// WorkflowJob represents a single job within a workflow, the job may also depend on existing jobs by UID
+type WorkflowJob struct {
+	Ref       string   `json:"ref"`
+	QueueName string   `json:"queue_name"`
+	DependsOn []string `json:"depends_on,omitempty"`
+	Job       *Job     `json:"job"`
+}
+
+// WorkflowStatus represents the progress of a workflow, the state is 'complete' once all its jobs are complete and
+// 'failed' if any have failed
+type WorkflowStatus struct {
+	ID     string               `json:"workflow_id"`
+	State  string               `json:"state"`
+	Counts map[string]int       `json:"counts"`
+	Jobs   []*WorkflowJobStatus `json:"jobs"`
+}
+
+// WorkflowJobStatus represents the state of a single job within a workflow
+type WorkflowJobStatus struct {
+	UID       string `json:"uid"`
+	QueueName string `json:"queue_name"`
+	State     string `json:"state"`
+}
+
+// AddWorkflow adds all the jobs in the given workflow in a single operation, either every job is added or none are. The
+// access key must be valid for every queue the workflow uses, each job must already have a UID set. Returns a copy of
+// the workflow holding copies of its jobs as added, made before the locks of the queues are released
+func (c *QueryControl) AddWorkflow(workflow *Workflow, accessKey string) (*Workflow, error) {
+	if workflow == nil || len(workflow.ID) == 0 || len(workflow.Jobs) == 0 || len(accessKey) == 0 {
+		return nil, fmt.Errorf("Invalid Args")
+	}
+
+	refs := make(map[string]*WorkflowJob, len(workflow.Jobs))
+	pending := make(map[string]bool, len(workflow.Jobs))
+	for _, item := range workflow.Jobs {
+		if item == nil || item.Job == nil || len(item.Ref) == 0 || len(item.QueueName) == 0 || len(item.Job.UID) == 0 || !validJob(item.Job) {
+			return nil, fmt.Errorf("Invalid Args")
+		} else if _, found := refs[item.Ref]; found {
+			return nil, fmt.Errorf("Invalid Args")
+		}
+		refs[item.Ref] = item
+		pending[item.Job.UID] = true
+	}
+
+	ordered, err := orderWorkflow(workflow.Jobs, refs)
+	if err != nil {
+		return nil, err
+	}
+
+	hashedKey, err := c.hash.Process(accessKey)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(ordered))
+	for _, item := range ordered {
+		names = append(names, item.QueueName)
+		names = append(names, dependencyQueues(item.Job)...)
+	}
+	defer c.lockQueues(false, names...)()
+
+	unique := make(map[[2]string]bool, len(ordered))
+	for _, item := range ordered {
+		queue, found := c.db.Queues[item.QueueName]
+		if !found {
+			return nil, fmt.Errorf("Not Found")
+		} else if queue.AccessKey != hashedKey {
+			return nil, fmt.Errorf("Unauthorized")
+		} else if !c.validateDependencies(item.Job, pending) {
+			return nil, fmt.Errorf("Invalid Args")
+		} else if queue.uniqueConflict(item.Job) != nil {
+			return nil, fmt.Errorf("Job Exists")
+		}
+
+		// jobs within the workflow must not match the unique fields of each other either
+		if key, ok := queue.uniqueKey(item.Job); ok {
+			if unique[[2]string{queue.Name, key}] {
+				return nil, fmt.Errorf("Job Exists")
+			}
+			unique[[2]string{queue.Name, key}] = true
+		}
+	}
+
+	currentTime := time.Now().Unix()
+	for _, item := range ordered {
+		for _, ref := range item.DependsOn {
+			parent := refs[ref]
+			item.Job.DependsOn = append(item.Job.DependsOn, &JobDependency{QueueName: parent.QueueName, UID: parent.Job.UID})
+		}
+		item.Job.WorkflowID = workflow.ID
+		c.insertJob(c.db.Queues[item.QueueName], item.Job, currentTime)
+	}
+
+	result := &Workflow{ID: workflow.ID, Jobs: make([]*WorkflowJob, len(workflow.Jobs))}
+	for i, item := range workflow.Jobs {
+		copied := *item
+		copied.Job = item.Job.copy()
+		result.Jobs[i] = &copied
+	}
+	return result, nil
+}
+
+// GetWorkflow returns the status of the given workflow, the workflow must have a job within the given queue. Jobs removed
+// once outside their keep window are no longer reported
+func (c *QueryControl) GetWorkflow(workflowID, queueName, accessKey string) (*WorkflowStatus, error) {
+	if len(workflowID) == 0 || len(queueName) == 0 || len(accessKey) == 0 {
+		return nil, fmt.Errorf("Invalid Args")
+	}
+
+	hashedKey, err := c.hash.Process(accessKey)
+	if err != nil {
+		return nil, err
+	}
+
+	c.readLockDB()
+	defer c.db.lock.RUnlock()
+
+	queue, found := c.db.Queues[queueName]
+	if !found {
+		return nil, fmt.Errorf("Not Found")
+	} else if queue.AccessKey != hashedKey {
+		return nil, fmt.Errorf("Unauthorized")
+	}
+
+	status := &WorkflowStatus{
+		ID:     workflowID,
+		Counts: make(map[string]int),
+		Jobs:   make([]*WorkflowJobStatus, 0),
+	}
+
+	authorized := false
+	for _, workflowQueue := range c.db.Queues {
+		workflowQueue.lock.Lock()
+		for _, job := range workflowQueue.Jobs {
+			if job.WorkflowID != workflowID {
+				continue
+			}
+
+			authorized = authorized || workflowQueue.Name == queueName
+			status.Counts[job.State]++
+			status.Jobs = append(status.Jobs, &WorkflowJobStatus{UID: job.UID, QueueName: workflowQueue.Name, State: job.State})
+		}
+		workflowQueue.lock.Unlock()
+	}
+
+	if !authorized {
+		return nil, fmt.Errorf("Not Found")
+	}
+
+	switch {
+	case status.Counts[Failed] > 0 || status.Counts[DeadLettered] > 0:
+		status.State = Failed
+	case status.Counts[Complete] == len(status.Jobs):
+		status.State = Complete
+	default:
+		status.State = Inprogress
+	}
+
+	return status, nil
+}
+
+// orderWorkflow returns the workflow jobs ordered so each job follows the jobs it depends on, returns an error if a
+// reference is unknown or the dependencies form a cycle
+func orderWorkflow(jobs []*WorkflowJob, refs map[string]*WorkflowJob) ([]*WorkflowJob, error) {
+	remaining := make(map[string]int, len(jobs))
+	children := make(map[string][]*WorkflowJob, len(jobs))
+	for _, item := range jobs {
+		for _, ref := range item.DependsOn {
+			if _, found := refs[ref]; !found || ref == item.Ref {
+				return nil, fmt.Errorf("Invalid Args")
+			}
+			children[ref] = append(children[ref], item)
+		}
+		remaining[item.Ref] = len(item.DependsOn)
+	}
+
+	ordered := make([]*WorkflowJob, 0, len(jobs))
+	for _, item := range jobs {
+		if remaining[item.Ref] == 0 {
+			ordered = append(ordered, item)
+		}
+	}
+
+	for i := 0; i < len(ordered); i++ {
+		for _, child := range children[ordered[i].Ref] {
+			if remaining[child.Ref]--; remaining[child.Ref] == 0 {
+				ordered = append(ordered, child)
+			}
+		}
+	}
+
+	if len(ordered) != len(jobs) {
+		return nil, fmt.Errorf("Invalid Args")
+	}
+	return ordered, nil
+}
@@ -0,0 +1,146 @@
+package database
+
+import "fmt"
+
+// WALPutQueue is the log operation for creating a queue or updating its settings
+const WALPutQueue string = "put_queue"
+
+// WALDeleteQueue is the log operation for removing a queue and all of its jobs
+const WALDeleteQueue string = "delete_queue"
+
+// WALPutJob is the log operation for adding a job or replacing its current state
+const WALPutJob string = "put_job"
+
+// WALDeleteJob is the log operation for removing a job from a queue
+const WALDeleteJob string = "delete_job"
+
+// WALPutSchedule is the log operation for adding a schedule or replacing its current state
+const WALPutSchedule string = "put_schedule"
+
+// WALDeleteSchedule is the log operation for removing a schedule from a queue
+const WALDeleteSchedule string = "delete_schedule"
+
+// WALPutIdempotencyKey is the log operation for recording the job created with an idempotency key
+const WALPutIdempotencyKey string = "put_idempotency_key"
+
+// WALEntry represents a single mutation to the DBFile, recorded in the write-ahead log. Entries hold the resulting state
+// rather than the request, so replaying an entry that is already reflected in a snapshot has no effect
+type WALEntry struct {
+	Op        string          `json:"op"`
+	QueueName string          `json:"queue_name"`
+	UID       string          `json:"uid,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Queue     *Queue          `json:"queue,omitempty"`
+	Job       *Job            `json:"job,omitempty"`
+	Schedule  *Schedule       `json:"schedule,omitempty"`
+	Key       *IdempotencyKey `json:"idempotency_key,omitempty"`
+}
+
+// newQueueEntry creates a WALPutQueue entry holding a copy of the queue settings, without its jobs
+func newQueueEntry(queue *Queue) *WALEntry {
+	settings := *queue
+	settings.Jobs = nil
+	settings.Schedules = nil
+	settings.IdempotencyKeys = nil
+	settings.keyOrder = nil
+	settings.uniqueJobs = nil
+	settings.stats = nil
+	settings.indexed = nil
+	settings.lock = nil
+	return &WALEntry{Op: WALPutQueue, QueueName: queue.Name, Queue: &settings}
+}
+
+// newJobEntry creates a WALPutJob entry holding a copy of the jobs current state
+func newJobEntry(queueName string, job *Job) *WALEntry {
+	return &WALEntry{Op: WALPutJob, QueueName: queueName, UID: job.UID, Job: job.copy()}
+}
+
+// newScheduleEntry creates a WALPutSchedule entry holding a copy of the schedules current state
+func newScheduleEntry(queueName string, schedule *Schedule) *WALEntry {
+	state := *schedule
+	return &WALEntry{Op: WALPutSchedule, QueueName: queueName, Name: schedule.Name, Schedule: &state}
+}
+
+// apply performs the given log entry against the DBFile - must handle Lock outside of this function
+func (db *DBFile) apply(entry *WALEntry) error {
+	switch {
+	case entry.Op == WALPutQueue:
+		if entry.Queue == nil {
+			return fmt.Errorf("Missing Queue For %s", entry.Op)
+		}
+		queue := *entry.Queue
+		queue.Jobs = make([]*Job, 0)
+		queue.Schedules = make(map[string]*Schedule)
+		queue.IdempotencyKeys = nil
+		if existing, found := db.Queues[entry.QueueName]; found {
+			queue.Jobs = existing.Jobs
+			queue.Schedules = existing.Schedules
+			queue.IdempotencyKeys = existing.IdempotencyKeys
+		}
+		queue.Size = len(queue.Jobs)
+		db.Queues[entry.QueueName] = &queue
+	case entry.Op == WALDeleteQueue:
+		delete(db.Queues, entry.QueueName)
+	case entry.Op == WALPutJob:
+		if entry.Job == nil {
+			return fmt.Errorf("Missing Job For %s", entry.Op)
+		}
+		queue, found := db.Queues[entry.QueueName]
+		if !found {
+			return nil
+		}
+		job := *entry.Job
+		for i, existing := range queue.Jobs {
+			if existing.UID == job.UID {
+				queue.Jobs[i] = &job
+				return nil
+			}
+		}
+		queue.Jobs = append(queue.Jobs, &job)
+		queue.Size = len(queue.Jobs)
+	case entry.Op == WALDeleteJob:
+		queue, found := db.Queues[entry.QueueName]
+		if !found {
+			return nil
+		}
+		for i, existing := range queue.Jobs {
+			if existing.UID == entry.UID {
+				copy(queue.Jobs[i:], queue.Jobs[i+1:])
+				queue.Jobs[len(queue.Jobs)-1] = nil
+				queue.Jobs = queue.Jobs[:len(queue.Jobs)-1]
+				break
+			}
+		}
+		queue.Size = len(queue.Jobs)
+	case entry.Op == WALPutSchedule:
+		if entry.Schedule == nil {
+			return fmt.Errorf("Missing Schedule For %s", entry.Op)
+		}
+		if queue, found := db.Queues[entry.QueueName]; found {
+			schedule := *entry.Schedule
+			if queue.Schedules == nil {
+				queue.Schedules = make(map[string]*Schedule)
+			}
+			queue.Schedules[entry.Name] = &schedule
+		}
+	case entry.Op == WALDeleteSchedule:
+		if queue, found := db.Queues[entry.QueueName]; found {
+			delete(queue.Schedules, entry.Name)
+		}
+	case entry.Op == WALPutIdempotencyKey:
+		if entry.Key == nil {
+			return fmt.Errorf("Missing Idempotency Key For %s", entry.Op)
+		}
+		if queue, found := db.Queues[entry.QueueName]; found {
+			record := *entry.Key
+			if queue.IdempotencyKeys == nil {
+				queue.IdempotencyKeys = make(map[string]*IdempotencyKey)
+			}
+			queue.IdempotencyKeys[entry.Name] = &record
+		}
+	default:
+		return fmt.Errorf("Unknown Log Operation %s", entry.Op)
+	}
+
+	return nil
+}
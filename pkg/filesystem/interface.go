@@ -6,6 +6,11 @@ type FileSystem interface {
 	DeleteFile(filepath string) error
 	ReadFile(filepath string) ([]byte, error)
 	WriteFile(filepath string, data []byte) error
+	AppendFile(filepath string, data []byte) error
+	Rename(oldpath, newpath string) error
+	SyncFile(filepath string) error
+	SyncDir(dirpath string) error
+	FileSize(filepath string) (int64, error)
 	GetEnv(name string) string
 }
 
@@ -42,6 +42,76 @@ func (o *OperatingSystem) WriteFile(filepath string, data []byte) error {
 	return ioutil.WriteFile(filepath, data, 0644)
 }
 
+// AppendFile appends data onto the end of a file, creating it if required, and syncs it to disk before returning
+func (o *OperatingSystem) AppendFile(filepath string, data []byte) error {
+	if len(filepath) <= 0 || len(data) <= 0 {
+		return fmt.Errorf("Invalid Args")
+	}
+
+	file, err := os.OpenFile(filepath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err = file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err = file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// Rename is a small wrapper for os.Rename, replaces newpath atomically if it already exists
+func (o *OperatingSystem) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+// SyncFile flushes the contents of the given file to disk
+func (o *OperatingSystem) SyncFile(filepath string) error {
+	file, err := os.OpenFile(filepath, os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+
+	if err = file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// SyncDir flushes the entries of the given directory to disk, making creates, renames and deletes within it durable
+func (o *OperatingSystem) SyncDir(dirpath string) error {
+	dir, err := os.Open(dirpath)
+	if err != nil {
+		return err
+	}
+
+	if err = dir.Sync(); err != nil {
+		dir.Close()
+		return err
+	}
+
+	return dir.Close()
+}
+
+// FileSize returns the size in bytes of the given file, 0 if it does not exist
+func (o *OperatingSystem) FileSize(filepath string) (int64, error) {
+	info, err := os.Stat(filepath)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
 // GetEnv returns the requested environment variable or nothing if it was not found
 func (o *OperatingSystem) GetEnv(name string) string {
 	return os.Getenv(name)
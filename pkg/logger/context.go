@@ -0,0 +1,23 @@
+package logger
+
+import "context"
+
+// contextKey is the type of the key used to store a logger in a context
+type contextKey int
+
+// loggerKey stores the logger of a request in a context
+const loggerKey contextKey = 0
+
+// NewContext returns a copy of ctx holding the given logger
+func NewContext(ctx context.Context, logger Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, logger)
+}
+
+// FromContext returns the logger held by ctx, nil if there is none
+func FromContext(ctx context.Context) Logger {
+	if ctx == nil {
+		return nil
+	}
+	logger, _ := ctx.Value(loggerKey).(Logger)
+	return logger
+}
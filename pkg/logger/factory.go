@@ -1,10 +1,21 @@
 package logger
 
-// NewLogger creates a class that can be used for logging
-func NewLogger(logType string) Logger {
+// NewLogger creates a class that can be used for logging at the given level, 'info' if empty
+func NewLogger(logType, level string) Logger {
+	minLevel := LevelInfo
+	if len(level) > 0 {
+		parsed, ok := ParseLevel(level)
+		if !ok {
+			return nil
+		}
+		minLevel = parsed
+	}
+
 	switch {
-	case logType == "std":
-		return NewStdLogger()
+	case logType == "std", logType == "text":
+		return NewStdLogger(minLevel)
+	case logType == "json":
+		return NewJSONLogger(minLevel)
 	default:
 		return nil
 	}
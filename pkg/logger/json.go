@@ -0,0 +1,93 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// JSONLogger logs each message as a JSON object on a single line to StdOut, StdErr, with fields as keys of the object
+type JSONLogger struct {
+	output *output
+	level  Level
+	fields []Field
+}
+
+// NewJSONLogger creates a new instance of a JSON logger to StdOut, StdErr
+func NewJSONLogger(level Level) *JSONLogger {
+	return &JSONLogger{
+		output: newOutput(),
+		level:  level,
+	}
+}
+
+// Debug logs a message to StdOut
+func (l *JSONLogger) Debug(msg string, fields ...Field) error {
+	return l.write(LevelDebug, msg, fields)
+}
+
+// Info logs a message to StdOut
+func (l *JSONLogger) Info(msg string, fields ...Field) error {
+	return l.write(LevelInfo, msg, fields)
+}
+
+// Warn logs a message to StdOut
+func (l *JSONLogger) Warn(msg string, fields ...Field) error {
+	return l.write(LevelWarn, msg, fields)
+}
+
+// Error logs a message to StdErr
+func (l *JSONLogger) Error(msg string, fields ...Field) error {
+	return l.write(LevelError, msg, fields)
+}
+
+// Fatal logs a message and exits the application, designed to be used in startup
+func (l *JSONLogger) Fatal(msg string, fields ...Field) error {
+	l.write(LevelFatal, msg, fields)
+	os.Exit(1)
+	return nil
+}
+
+// With returns a logger adding the given fields to every message
+func (l *JSONLogger) With(fields ...Field) Logger {
+	return &JSONLogger{
+		output: l.output,
+		level:  l.level,
+		fields: appendFields(l.fields, fields),
+	}
+}
+
+// write formats the message as a JSON object if it is at or above the level of the logger, fields keep the order given
+func (l *JSONLogger) write(level Level, msg string, fields []Field) error {
+	if level < l.level {
+		return nil
+	}
+
+	var line bytes.Buffer
+	line.WriteString(`{"time":`)
+	writeJSONValue(&line, time.Now().UTC().Format(time.RFC3339Nano))
+	line.WriteString(`,"level":`)
+	writeJSONValue(&line, level.String())
+	line.WriteString(`,"msg":`)
+	writeJSONValue(&line, msg)
+	for _, field := range appendFields(l.fields, fields) {
+		line.WriteString(",")
+		writeJSONValue(&line, field.Key)
+		line.WriteString(":")
+		writeJSONValue(&line, field.Value)
+	}
+	line.WriteString("}\n")
+
+	return l.output.write(level, line.Bytes())
+}
+
+// writeJSONValue writes the value as JSON, values that cannot be encoded are written as text
+func writeJSONValue(buffer *bytes.Buffer, value interface{}) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		encoded, _ = json.Marshal(fmt.Sprint(value))
+	}
+	buffer.Write(encoded)
+}
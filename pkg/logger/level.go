@@ -0,0 +1,45 @@
+package logger
+
+import "strings"
+
+// Level is the severity of a message, messages below the level of a logger are not logged
+type Level int
+
+// LevelDebug is for detail only useful when diagnosing a problem
+const LevelDebug Level = 0
+
+// LevelInfo is for the normal operation of the application
+const LevelInfo Level = 1
+
+// LevelWarn is for problems the application recovers from
+const LevelWarn Level = 2
+
+// LevelError is for problems causing a request or operation to fail
+const LevelError Level = 3
+
+// LevelFatal is for problems the application cannot continue after
+const LevelFatal Level = 4
+
+// levelNames are the names of each level as logged
+var levelNames = map[Level]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+	LevelFatal: "fatal",
+}
+
+// String returns the name of the level
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+// ParseLevel returns the level with the given name, false if there is none
+func ParseLevel(name string) (Level, bool) {
+	for level, levelName := range levelNames {
+		if levelName == strings.ToLower(name) {
+			return level, true
+		}
+	}
+	return LevelInfo, false
+}
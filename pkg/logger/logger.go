@@ -1,8 +1,25 @@
 package logger
 
-// Logger defines an object suitable for performing logging
+// Logger defines an object suitable for performing logging, each message can be given fields of extra detail
 type Logger interface {
-	Info(msg string) error
-	Error(msg string) error
-	Fatal(msg string) error
+	Debug(msg string, fields ...Field) error
+	Info(msg string, fields ...Field) error
+	Warn(msg string, fields ...Field) error
+	Error(msg string, fields ...Field) error
+	Fatal(msg string, fields ...Field) error
+	With(fields ...Field) Logger
+}
+
+// Field is a key and value logged alongside a message
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F is a constructor for a Field, errors are logged by their message
+func F(key string, value interface{}) Field {
+	if err, ok := value.(error); ok && err != nil {
+		value = err.Error()
+	}
+	return Field{Key: key, Value: value}
 }
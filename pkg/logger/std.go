@@ -1,38 +1,147 @@
 package logger
 
 import (
-	"log"
+	"fmt"
+	"io"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
-// StdLogger logs to StdOut, StdErr
+// StdLogger logs lines of text to StdOut, StdErr with fields as key=value pairs
 type StdLogger struct {
-	stdOut *log.Logger
-	stdErr *log.Logger
+	output *output
+	level  Level
+	fields []Field
 }
 
 // NewStdLogger creates a new instance of a logger to StdOut, StdErr
-func NewStdLogger() *StdLogger {
+func NewStdLogger(level Level) *StdLogger {
 	return &StdLogger{
-		stdOut: log.New(os.Stdout, "INFO: ", log.LstdFlags),
-		stdErr: log.New(os.Stderr, "ERROR: ", log.LstdFlags),
+		output: newOutput(),
+		level:  level,
 	}
 }
 
+// Debug logs a message to StdOut
+func (l *StdLogger) Debug(msg string, fields ...Field) error {
+	return l.write(LevelDebug, msg, fields)
+}
+
 // Info logs a message to StdOut
-func (l *StdLogger) Info(msg string) error {
-	l.stdOut.Print(msg)
-	return nil
+func (l *StdLogger) Info(msg string, fields ...Field) error {
+	return l.write(LevelInfo, msg, fields)
+}
+
+// Warn logs a message to StdOut
+func (l *StdLogger) Warn(msg string, fields ...Field) error {
+	return l.write(LevelWarn, msg, fields)
 }
 
 // Error logs a message to StdErr
-func (l *StdLogger) Error(msg string) error {
-	l.stdErr.Print(msg)
-	return nil
+func (l *StdLogger) Error(msg string, fields ...Field) error {
+	return l.write(LevelError, msg, fields)
 }
 
 // Fatal logs a message and exits the application, designed to be used in startup
-func (l *StdLogger) Fatal(msg string) error {
-	l.stdErr.Fatal(msg)
+func (l *StdLogger) Fatal(msg string, fields ...Field) error {
+	l.write(LevelFatal, msg, fields)
+	os.Exit(1)
 	return nil
 }
+
+// With returns a logger adding the given fields to every message
+func (l *StdLogger) With(fields ...Field) Logger {
+	return &StdLogger{
+		output: l.output,
+		level:  l.level,
+		fields: appendFields(l.fields, fields),
+	}
+}
+
+// write formats the message as a line of text if it is at or above the level of the logger
+func (l *StdLogger) write(level Level, msg string, fields []Field) error {
+	if level < l.level {
+		return nil
+	}
+
+	var line strings.Builder
+	line.WriteString(strings.ToUpper(level.String()))
+	line.WriteString(": ")
+	line.WriteString(time.Now().Format("2006/01/02 15:04:05"))
+	line.WriteString(" ")
+	line.WriteString(msg)
+	for _, field := range appendFields(l.fields, fields) {
+		line.WriteString(" ")
+		line.WriteString(field.Key)
+		line.WriteString("=")
+		line.WriteString(textValue(field.Value))
+	}
+	line.WriteString("\n")
+
+	return l.output.write(level, []byte(line.String()))
+}
+
+// textValue returns the value as text, quoted if it would otherwise be ambiguous
+func textValue(value interface{}) string {
+	text := fmt.Sprint(value)
+	if len(text) == 0 || strings.ContainsAny(text, " \t\n\"=") {
+		return strconv.Quote(text)
+	}
+	return text
+}
+
+// output writes lines to StdOut, or StdErr for errors, one line at a time
+type output struct {
+	lock   sync.Mutex
+	stdOut io.Writer
+	stdErr io.Writer
+}
+
+// newOutput is a constructor for an output to StdOut, StdErr
+func newOutput() *output {
+	return &output{
+		stdOut: os.Stdout,
+		stdErr: os.Stderr,
+	}
+}
+
+// write writes the line to the writer for the level
+func (o *output) write(level Level, line []byte) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	writer := o.stdOut
+	if level >= LevelError {
+		writer = o.stdErr
+	}
+	_, err := writer.Write(line)
+	return err
+}
+
+// appendFields returns the fields of a logger followed by those of a message without modifying either, a field of the
+// message replaces a field of the logger with the same key
+func appendFields(fields, extra []Field) []Field {
+	if len(extra) == 0 {
+		return fields
+	}
+
+	result := make([]Field, 0, len(fields)+len(extra))
+	result = append(result, fields...)
+	for _, field := range extra {
+		replaced := false
+		for i := range result {
+			if result[i].Key == field.Key {
+				result[i] = field
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			result = append(result, field)
+		}
+	}
+	return result
+}
@@ -0,0 +1,59 @@
+package metrics
+
+import "math"
+
+// DefaultBuckets are the upper bounds in seconds of histogram buckets suited to request latencies
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Histogram counts observations into buckets by their upper bound, along with their sum and count. It is not safe for
+// concurrent use, see HistogramVec
+type Histogram struct {
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+// NewHistogram is a constructor for a Histogram with the given ascending bucket upper bounds
+func NewHistogram(buckets []float64) *Histogram {
+	return &Histogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+// Observe counts the given value into every bucket with an upper bound at or above it
+func (h *Histogram) Observe(value float64) {
+	for i, bound := range h.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += value
+	h.count++
+}
+
+// samples returns the bucket, sum and count samples of the histogram with the given labels
+func (h *Histogram) samples(name string, labels []Label) []*Sample {
+	result := make([]*Sample, 0, len(h.buckets)+3)
+	for i, bound := range h.buckets {
+		result = append(result, &Sample{
+			Name:   name + "_bucket",
+			Labels: withLabel(labels, "le", formatValue(bound)),
+			Value:  float64(h.counts[i]),
+		})
+	}
+	result = append(result,
+		&Sample{Name: name + "_bucket", Labels: withLabel(labels, "le", formatValue(math.Inf(1))), Value: float64(h.count)},
+		&Sample{Name: name + "_sum", Labels: labels, Value: h.sum},
+		&Sample{Name: name + "_count", Labels: labels, Value: float64(h.count)},
+	)
+	return result
+}
+
+// withLabel returns a copy of the labels with the given label appended
+func withLabel(labels []Label, name, value string) []Label {
+	result := make([]Label, len(labels), len(labels)+1)
+	copy(result, labels)
+	return append(result, Label{Name: name, Value: value})
+}
@@ -0,0 +1,56 @@
+package metrics
+
+// Counter is the type of a metric that only increases, other than resetting to zero when the application restarts
+const Counter string = "counter"
+
+// Gauge is the type of a metric that can increase and decrease
+const Gauge string = "gauge"
+
+// HistogramType is the type of a metric counting observations into buckets
+const HistogramType string = "histogram"
+
+// Label is a name and value identifying a sample within a family
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is a single value of a family, the name includes any suffix such as '_bucket'
+type Sample struct {
+	Name   string
+	Labels []Label
+	Value  float64
+}
+
+// Family is the samples of a single metric
+type Family struct {
+	Name    string
+	Help    string
+	Type    string
+	Samples []*Sample
+}
+
+// Collector presents an object that returns its metrics when they are requested
+type Collector interface {
+	Collect() []*Family
+}
+
+// NewFamily is a constructor for an empty Family
+func NewFamily(name, help, metricType string) *Family {
+	return &Family{
+		Name:    name,
+		Help:    help,
+		Type:    metricType,
+		Samples: make([]*Sample, 0),
+	}
+}
+
+// Add appends a sample of the family with the given value and labels
+func (f *Family) Add(value float64, labels ...Label) {
+	f.Samples = append(f.Samples, &Sample{Name: f.Name, Labels: labels, Value: value})
+}
+
+// AddHistogram appends the samples of the given histogram to the family with the given labels
+func (f *Family) AddHistogram(histogram *Histogram, labels ...Label) {
+	f.Samples = append(f.Samples, histogram.samples(f.Name, labels)...)
+}
@@ -0,0 +1,4 @@
+/*
+Package metrics records counters, gauges and histograms and writes them in the Prometheus text exposition format
+*/
+package metrics
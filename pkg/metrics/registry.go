@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the content type of the Prometheus text exposition format
+const ContentType string = "text/plain; version=0.0.4; charset=utf-8"
+
+// Registry holds the collectors whose metrics are written together
+type Registry struct {
+	lock       sync.Mutex
+	collectors []Collector
+}
+
+// NewRegistry is a constructor for a Registry of the given collectors, nil collectors are ignored
+func NewRegistry(collectors ...Collector) *Registry {
+	registry := &Registry{collectors: make([]Collector, 0, len(collectors))}
+	for _, collector := range collectors {
+		registry.Register(collector)
+	}
+	return registry
+}
+
+// Register adds the given collector to the registry
+func (r *Registry) Register(collector Collector) {
+	if collector == nil {
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.collectors = append(r.collectors, collector)
+}
+
+// Write writes the metrics of every collector to w in the order they were registered
+func (r *Registry) Write(w io.Writer) error {
+	r.lock.Lock()
+	collectors := append([]Collector(nil), r.collectors...)
+	r.lock.Unlock()
+
+	var buffer bytes.Buffer
+	for _, collector := range collectors {
+		for _, family := range collector.Collect() {
+			writeFamily(&buffer, family)
+		}
+	}
+
+	_, err := w.Write(buffer.Bytes())
+	return err
+}
+
+// ServeHTTP is an endpoint handler returning the metrics of the registry
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	r.Write(w)
+}
+
+// writeFamily writes the help, type and samples of the family to the buffer
+func writeFamily(buffer *bytes.Buffer, family *Family) {
+	buffer.WriteString("# HELP " + family.Name + " " + escapeHelp(family.Help) + "\n")
+	buffer.WriteString("# TYPE " + family.Name + " " + family.Type + "\n")
+
+	for _, sample := range family.Samples {
+		buffer.WriteString(sample.Name)
+		if len(sample.Labels) > 0 {
+			buffer.WriteByte('{')
+			for i, label := range sample.Labels {
+				if i > 0 {
+					buffer.WriteByte(',')
+				}
+				buffer.WriteString(label.Name + "=\"" + escapeLabel(label.Value) + "\"")
+			}
+			buffer.WriteByte('}')
+		}
+		buffer.WriteString(" " + formatValue(sample.Value) + "\n")
+	}
+}
+
+// formatValue returns the value as written in the exposition format
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
+
+// escapeHelp escapes backslashes and line breaks in help text
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+// escapeLabel escapes backslashes, quotes and line breaks in a label value
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+// update rewrites the golden files with the output of the tests rather than comparing against them
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+// familyCollector is a collector returning the given families
+type familyCollector []*Family
+
+func (c familyCollector) Collect() []*Family {
+	return c
+}
+
+// checkGolden compares the output with the golden file of the given name in testdata
+func checkGolden(t *testing.T, name string, output []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := ioutil.WriteFile(path, output, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(output, expected) {
+		t.Errorf("output does not match %s\ngot:\n%s\nwant:\n%s", path, output, expected)
+	}
+}
+
+// serve returns the response of the registry to a metrics request
+func serve(t *testing.T, registry *Registry) []byte {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	registry.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status %d, want %d", recorder.Code, http.StatusOK)
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != ContentType {
+		t.Errorf("content type %q, want %q", contentType, ContentType)
+	}
+	return recorder.Body.Bytes()
+}
+
+func TestRegistryServeHTTPVecs(t *testing.T) {
+	requests := NewCounterVec("test_requests_total", "Number of requests handled", "method", "status")
+	requests.Inc("GET", "200")
+	requests.Inc("GET", "200")
+	requests.Add(3, "PUT", "409")
+	requests.Inc("DELETE", "404")
+
+	depth := NewGaugeVec("test_queue_depth", "Jobs held by each queue", "queue")
+	depth.Set(12, "emails")
+	depth.Set(0, "reports")
+
+	latency := NewHistogramVec("test_request_seconds", "Seconds taken to handle requests", []float64{0.1, 0.5, 1}, "route")
+	latency.Observe(0.05, "/api/v1/job")
+	latency.Observe(0.3, "/api/v1/job")
+	latency.Observe(2, "/api/v1/job")
+	latency.Observe(0.5, "/api/v1/queue")
+
+	checkGolden(t, "vecs", serve(t, NewRegistry(requests, depth, nil, latency)))
+}
+
+func TestRegistryServeHTTPFamilies(t *testing.T) {
+	counter := NewFamily("test_saves_total", "Saves made\nto the \\ database", Counter)
+	counter.Add(7, Label{Name: "path", Value: `C:\db "main"` + "\nfile"})
+
+	gauge := NewFamily("test_limits", "Limits of the queue", Gauge)
+	gauge.Add(math.Inf(1), Label{Name: "queue", Value: "unbounded"})
+	gauge.Add(1.5e-7, Label{Name: "queue", Value: "small"})
+	gauge.Add(-2)
+
+	histogram := NewHistogram([]float64{1, 10})
+	histogram.Observe(0.5)
+	histogram.Observe(20)
+	sizes := NewFamily("test_batch_size", "Jobs in each batch", HistogramType)
+	sizes.AddHistogram(histogram, Label{Name: "queue", Value: "emails"}, Label{Name: "op", Value: "claim"})
+	sizes.AddHistogram(NewHistogram([]float64{1, 10}))
+
+	checkGolden(t, "families", serve(t, NewRegistry(familyCollector{counter, gauge}, familyCollector{sizes})))
+}
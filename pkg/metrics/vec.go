@@ -0,0 +1,180 @@
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// labelSeparator joins label values into a key, it cannot appear in valid UTF-8
+const labelSeparator string = "\xff"
+
+// vec holds the values of a metric by its label values, safe for concurrent use
+type vec struct {
+	lock       sync.Mutex
+	name       string
+	help       string
+	labelNames []string
+	keys       map[string][]string
+}
+
+// key returns the key for the given label values, recording the values against it
+func (v *vec) key(values []string) string {
+	if len(values) != len(v.labelNames) {
+		// the values are padded or cut to the label names rather than dropped
+		padded := make([]string, len(v.labelNames))
+		copy(padded, values)
+		values = padded
+	}
+
+	key := strings.Join(values, labelSeparator)
+	if _, found := v.keys[key]; !found {
+		v.keys[key] = append([]string(nil), values...)
+	}
+	return key
+}
+
+// sortedKeys returns the keys recorded in order, so samples are written consistently
+func (v *vec) sortedKeys() []string {
+	keys := make([]string, 0, len(v.keys))
+	for key := range v.keys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// labelsFor returns the labels of the given key
+func (v *vec) labelsFor(key string) []Label {
+	values := v.keys[key]
+	labels := make([]Label, len(v.labelNames))
+	for i, name := range v.labelNames {
+		labels[i] = Label{Name: name, Value: values[i]}
+	}
+	return labels
+}
+
+// CounterVec is a counter with a value for each combination of label values
+type CounterVec struct {
+	vec
+	values map[string]float64
+}
+
+// NewCounterVec is a constructor for a CounterVec with the given label names
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	return &CounterVec{
+		vec:    vec{name: name, help: help, labelNames: labelNames, keys: make(map[string][]string)},
+		values: make(map[string]float64),
+	}
+}
+
+// Inc increases the counter with the given label values by 1
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increases the counter with the given label values by the given amount, negative amounts are ignored
+func (c *CounterVec) Add(amount float64, labelValues ...string) {
+	if amount < 0 {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.values[c.key(labelValues)] += amount
+}
+
+// Collect returns the counter values as a family
+func (c *CounterVec) Collect() []*Family {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	family := NewFamily(c.name, c.help, Counter)
+	for _, key := range c.sortedKeys() {
+		family.Add(c.values[key], c.labelsFor(key)...)
+	}
+	if len(c.labelNames) == 0 && len(family.Samples) == 0 {
+		// without labels there is a single value, reported as zero until it is first set
+		family.Add(0)
+	}
+	return []*Family{family}
+}
+
+// GaugeVec is a gauge with a value for each combination of label values
+type GaugeVec struct {
+	vec
+	values map[string]float64
+}
+
+// NewGaugeVec is a constructor for a GaugeVec with the given label names
+func NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	return &GaugeVec{
+		vec:    vec{name: name, help: help, labelNames: labelNames, keys: make(map[string][]string)},
+		values: make(map[string]float64),
+	}
+}
+
+// Set sets the gauge with the given label values
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.values[g.key(labelValues)] = value
+}
+
+// Collect returns the gauge values as a family
+func (g *GaugeVec) Collect() []*Family {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	family := NewFamily(g.name, g.help, Gauge)
+	for _, key := range g.sortedKeys() {
+		family.Add(g.values[key], g.labelsFor(key)...)
+	}
+	if len(g.labelNames) == 0 && len(family.Samples) == 0 {
+		// without labels there is a single value, reported as zero until it is first set
+		family.Add(0)
+	}
+	return []*Family{family}
+}
+
+// HistogramVec is a histogram for each combination of label values
+type HistogramVec struct {
+	vec
+	buckets    []float64
+	histograms map[string]*Histogram
+}
+
+// NewHistogramVec is a constructor for a HistogramVec with the given ascending bucket upper bounds and label names
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	return &HistogramVec{
+		vec:        vec{name: name, help: help, labelNames: labelNames, keys: make(map[string][]string)},
+		buckets:    buckets,
+		histograms: make(map[string]*Histogram),
+	}
+}
+
+// Observe counts the given value into the histogram with the given label values
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	key := h.key(labelValues)
+	histogram, found := h.histograms[key]
+	if !found {
+		histogram = NewHistogram(h.buckets)
+		h.histograms[key] = histogram
+	}
+	histogram.Observe(value)
+}
+
+// Collect returns the histograms as a family
+func (h *HistogramVec) Collect() []*Family {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	family := NewFamily(h.name, h.help, HistogramType)
+	for _, key := range h.sortedKeys() {
+		family.AddHistogram(h.histograms[key], h.labelsFor(key)...)
+	}
+	return []*Family{family}
+}
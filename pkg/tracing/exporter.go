@@ -0,0 +1,228 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// otlpBatchSize is the most spans sent to an OTLP collector in a single request
+const otlpBatchSize int = 512
+
+// otlpQueueSize is the most spans held waiting to be sent to an OTLP collector, further spans are dropped
+const otlpQueueSize int = 4096
+
+// otlpInterval is how often spans waiting to be sent to an OTLP collector are sent if a batch has not filled
+const otlpInterval = 5 * time.Second
+
+// Exporter presents an object that sends ended spans outside of the application
+type Exporter interface {
+	Export(serviceName string, span *Span) error
+	Shutdown() error
+}
+
+// NewExporter is a factory function for creating a derived instance of the Exporter interface. The target is the path of
+// the file for the 'file' exporter and the URL to send spans to for the 'otlp' exporter
+func NewExporter(exporterType, target string) Exporter {
+	switch {
+	case exporterType == "stdout":
+		return NewWriterExporter(os.Stdout)
+	case exporterType == "file":
+		if len(target) == 0 {
+			return nil
+		}
+		file, err := os.OpenFile(target, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil
+		}
+		return NewWriterExporter(file)
+	case exporterType == "otlp":
+		if len(target) == 0 {
+			return nil
+		}
+		return NewOTLPExporter(target)
+	default:
+		return nil
+	}
+}
+
+// spanRecord is the JSON representation of a span written by the WriterExporter
+type spanRecord struct {
+	Service       string                 `json:"service"`
+	TraceID       string                 `json:"trace_id"`
+	SpanID        string                 `json:"span_id"`
+	ParentSpanID  string                 `json:"parent_span_id,omitempty"`
+	Name          string                 `json:"name"`
+	Kind          string                 `json:"kind"`
+	Start         time.Time              `json:"start"`
+	End           time.Time              `json:"end"`
+	DurationMs    float64                `json:"duration_ms"`
+	Attributes    map[string]interface{} `json:"attributes,omitempty"`
+	Status        string                 `json:"status"`
+	StatusMessage string                 `json:"status_message,omitempty"`
+}
+
+// WriterExporter writes each span as a line of JSON, for local testing
+type WriterExporter struct {
+	lock   sync.Mutex
+	writer io.Writer
+}
+
+// NewWriterExporter is a constructor for a WriterExporter writing to the given writer
+func NewWriterExporter(writer io.Writer) *WriterExporter {
+	return &WriterExporter{writer: writer}
+}
+
+// Export writes the span to the writer
+func (e *WriterExporter) Export(serviceName string, span *Span) error {
+	record := &spanRecord{
+		Service:       serviceName,
+		TraceID:       span.Context.TraceID.String(),
+		SpanID:        span.Context.SpanID.String(),
+		Name:          span.Name,
+		Kind:          span.Kind,
+		Start:         span.StartTime,
+		End:           span.EndTime,
+		DurationMs:    float64(span.EndTime.Sub(span.StartTime)) / float64(time.Millisecond),
+		Attributes:    span.Attributes,
+		Status:        span.Status,
+		StatusMessage: span.StatusMessage,
+	}
+	if span.Parent != (SpanID{}) {
+		record.ParentSpanID = span.Parent.String()
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	_, err = e.writer.Write(append(line, '\n'))
+	return err
+}
+
+// Shutdown closes the writer if it is a file other than stdout or stderr
+func (e *WriterExporter) Shutdown() error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if file, ok := e.writer.(*os.File); ok && file != os.Stdout && file != os.Stderr {
+		return file.Close()
+	}
+	return nil
+}
+
+// OTLPExporter sends spans in batches to an OpenTelemetry collector using OTLP/HTTP with JSON encoding
+type OTLPExporter struct {
+	endpoint string
+	client   *http.Client
+	queue    chan *otlpSpan
+	done     chan struct{}
+	once     sync.Once
+}
+
+// NewOTLPExporter is a constructor for an OTLPExporter sending to the given URL, such as
+// 'http://localhost:4318/v1/traces'. Spans are sent from a background goroutine until Shutdown is called
+func NewOTLPExporter(endpoint string) *OTLPExporter {
+	exporter := &OTLPExporter{
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		queue:    make(chan *otlpSpan, otlpQueueSize),
+		done:     make(chan struct{}),
+	}
+	go exporter.run()
+	return exporter
+}
+
+// Export queues the span to be sent, the span is dropped if the queue is full
+func (e *OTLPExporter) Export(serviceName string, span *Span) error {
+	select {
+	case e.queue <- newOTLPSpan(serviceName, span):
+		return nil
+	default:
+		return fmt.Errorf("Export Queue Full")
+	}
+}
+
+// Shutdown sends the spans still queued and stops the background goroutine, spans exported after are not sent
+func (e *OTLPExporter) Shutdown() error {
+	e.once.Do(func() {
+		close(e.queue)
+	})
+	<-e.done
+	return nil
+}
+
+// run sends the queued spans whenever a batch fills or the interval passes, until the queue is closed
+func (e *OTLPExporter) run() {
+	defer close(e.done)
+
+	ticker := time.NewTicker(otlpInterval)
+	defer ticker.Stop()
+
+	batch := make([]*otlpSpan, 0, otlpBatchSize)
+	for {
+		select {
+		case span, open := <-e.queue:
+			if !open {
+				e.send(batch)
+				return
+			}
+			batch = append(batch, span)
+			if len(batch) >= otlpBatchSize {
+				e.send(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			e.send(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// send posts the given spans to the collector grouped by service, spans that fail to send are dropped
+func (e *OTLPExporter) send(spans []*otlpSpan) {
+	if len(spans) == 0 {
+		return
+	}
+
+	byService := make(map[string][]*otlpSpan)
+	order := make([]string, 0)
+	for _, span := range spans {
+		if _, found := byService[span.service]; !found {
+			order = append(order, span.service)
+		}
+		byService[span.service] = append(byService[span.service], span)
+	}
+
+	request := &otlpRequest{ResourceSpans: make([]*otlpResourceSpans, 0, len(order))}
+	for _, service := range order {
+		request.ResourceSpans = append(request.ResourceSpans, &otlpResourceSpans{
+			Resource: otlpResource{Attributes: []*otlpAttribute{newOTLPAttribute("service.name", service)}},
+			ScopeSpans: []*otlpScopeSpans{{
+				Scope: otlpScope{Name: service},
+				Spans: byService[service],
+			}},
+		})
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return
+	}
+
+	response, err := e.client.Post(e.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	io.Copy(ioutil.Discard, response.Body)
+	response.Body.Close()
+}
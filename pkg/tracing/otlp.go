@@ -0,0 +1,118 @@
+package tracing
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// otlpKinds maps the kinds of span to their OTLP values
+var otlpKinds = map[string]int{
+	KindInternal: 1,
+	KindServer:   2,
+}
+
+// otlpRequest is the body of an OTLP/HTTP export request in JSON encoding
+type otlpRequest struct {
+	ResourceSpans []*otlpResourceSpans `json:"resourceSpans"`
+}
+
+// otlpResourceSpans holds the spans of a single service
+type otlpResourceSpans struct {
+	Resource   otlpResource      `json:"resource"`
+	ScopeSpans []*otlpScopeSpans `json:"scopeSpans"`
+}
+
+// otlpResource describes the service spans were recorded by
+type otlpResource struct {
+	Attributes []*otlpAttribute `json:"attributes"`
+}
+
+// otlpScopeSpans holds the spans recorded by a single instrumentation scope
+type otlpScopeSpans struct {
+	Scope otlpScope   `json:"scope"`
+	Spans []*otlpSpan `json:"spans"`
+}
+
+// otlpScope names the instrumentation that recorded spans
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+// otlpSpan is a span in OTLP JSON encoding, ids are hex and times are nanoseconds as strings
+type otlpSpan struct {
+	service           string
+	TraceID           string           `json:"traceId"`
+	SpanID            string           `json:"spanId"`
+	TraceState        string           `json:"traceState,omitempty"`
+	ParentSpanID      string           `json:"parentSpanId,omitempty"`
+	Name              string           `json:"name"`
+	Kind              int              `json:"kind"`
+	StartTimeUnixNano string           `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string           `json:"endTimeUnixNano"`
+	Attributes        []*otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus       `json:"status"`
+}
+
+// otlpStatus is the status of a span, code 2 for an error
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// otlpAttribute is a key and typed value
+type otlpAttribute struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+// newOTLPSpan converts the given span to OTLP JSON encoding
+func newOTLPSpan(serviceName string, span *Span) *otlpSpan {
+	result := &otlpSpan{
+		service:           serviceName,
+		TraceID:           span.Context.TraceID.String(),
+		SpanID:            span.Context.SpanID.String(),
+		TraceState:        span.Context.TraceState,
+		Name:              span.Name,
+		Kind:              otlpKinds[span.Kind],
+		StartTimeUnixNano: strconv.FormatInt(span.StartTime.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(span.EndTime.UnixNano(), 10),
+	}
+	if span.Parent != (SpanID{}) {
+		result.ParentSpanID = span.Parent.String()
+	}
+	if span.Status == StatusError {
+		result.Status = otlpStatus{Code: 2, Message: span.StatusMessage}
+	}
+
+	keys := make([]string, 0, len(span.Attributes))
+	for key := range span.Attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		result.Attributes = append(result.Attributes, newOTLPAttribute(key, span.Attributes[key]))
+	}
+
+	return result
+}
+
+// newOTLPAttribute returns the key and value with the value typed as OTLP expects, 64-bit integers are strings
+func newOTLPAttribute(key string, value interface{}) *otlpAttribute {
+	var typed map[string]interface{}
+	switch v := value.(type) {
+	case bool:
+		typed = map[string]interface{}{"boolValue": v}
+	case int:
+		typed = map[string]interface{}{"intValue": strconv.Itoa(v)}
+	case int64:
+		typed = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+	case float64:
+		typed = map[string]interface{}{"doubleValue": v}
+	case string:
+		typed = map[string]interface{}{"stringValue": v}
+	default:
+		typed = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+	}
+	return &otlpAttribute{Key: key, Value: typed}
+}
@@ -0,0 +1,5 @@
+/*
+Package tracing records spans following the OpenTelemetry data model, propagating W3C trace context and exporting spans
+to stdout, a file or an OTLP/HTTP collector
+*/
+package tracing
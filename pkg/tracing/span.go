@@ -0,0 +1,73 @@
+package tracing
+
+import (
+	"sync"
+	"time"
+)
+
+// KindInternal is the kind of a span for an operation within the application
+const KindInternal string = "internal"
+
+// KindServer is the kind of a span for handling a request from a client
+const KindServer string = "server"
+
+// StatusUnset is the status of a span that has not recorded an error
+const StatusUnset string = "unset"
+
+// StatusError is the status of a span that has recorded an error
+const StatusError string = "error"
+
+// Span represents a single timed operation within a trace
+type Span struct {
+	lock          sync.Mutex
+	tracer        *Tracer
+	ended         bool
+	Name          string
+	Kind          string
+	Context       SpanContext
+	Parent        SpanID
+	StartTime     time.Time
+	EndTime       time.Time
+	Attributes    map[string]interface{}
+	Status        string
+	StatusMessage string
+}
+
+// SetAttribute records the given key and value against the span, values should be strings, numbers or bools
+func (s *Span) SetAttribute(key string, value interface{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.Attributes == nil {
+		s.Attributes = make(map[string]interface{})
+	}
+	s.Attributes[key] = value
+}
+
+// SetError marks the span as failed with the given error, nil errors are ignored
+func (s *Span) SetError(err error) {
+	if err == nil {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.Status = StatusError
+	s.StatusMessage = err.Error()
+}
+
+// End sets the end time of the span and exports it if sampled, only the first call has any effect
+func (s *Span) End() {
+	s.lock.Lock()
+	if s.ended {
+		s.lock.Unlock()
+		return
+	}
+	s.ended = true
+	s.EndTime = time.Now()
+	s.lock.Unlock()
+
+	if s.tracer != nil && s.Context.Sampled {
+		s.tracer.export(s)
+	}
+}
@@ -0,0 +1,114 @@
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
+// TraceParentHeader is the W3C trace context header holding the trace and parent span
+const TraceParentHeader string = "traceparent"
+
+// TraceStateHeader is the W3C trace context header holding vendor specific trace data
+const TraceStateHeader string = "tracestate"
+
+// TraceID identifies a trace across every service it passes through
+type TraceID [16]byte
+
+// SpanID identifies a span within a trace
+type SpanID [8]byte
+
+// String returns the trace id as lowercase hex
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// String returns the span id as lowercase hex
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// SpanContext is the part of a span propagated to other services
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Sampled    bool
+	TraceState string
+}
+
+// IsValid returns whether both the trace and span ids are set
+func (s SpanContext) IsValid() bool {
+	return s.TraceID != TraceID{} && s.SpanID != SpanID{}
+}
+
+// TraceParent returns the span context as a W3C traceparent header value, empty if it is not valid
+func (s SpanContext) TraceParent() string {
+	if !s.IsValid() {
+		return ""
+	}
+
+	flags := "00"
+	if s.Sampled {
+		flags = "01"
+	}
+	return "00-" + s.TraceID.String() + "-" + s.SpanID.String() + "-" + flags
+}
+
+// ParseTraceParent returns the span context of the given W3C traceparent header value, false if it is not valid. Later
+// versions of the header are read as version 00, as the specification requires
+func ParseTraceParent(traceParent, traceState string) (SpanContext, bool) {
+	var result SpanContext
+	traceParent = strings.TrimSpace(traceParent)
+
+	if len(traceParent) < 55 || (len(traceParent) > 55 && traceParent[55] != '-') {
+		return result, false
+	}
+
+	version := traceParent[0:2]
+	if version == "ff" || !isHex(version) || (version == "00" && len(traceParent) != 55) {
+		return result, false
+	} else if traceParent[2] != '-' || traceParent[35] != '-' || traceParent[52] != '-' {
+		return result, false
+	}
+
+	traceID, spanID, flags := traceParent[3:35], traceParent[36:52], traceParent[53:55]
+	if !isHex(traceID) || !isHex(spanID) || !isHex(flags) {
+		return result, false
+	}
+
+	hex.Decode(result.TraceID[:], []byte(traceID))
+	hex.Decode(result.SpanID[:], []byte(spanID))
+	flagBits, _ := hex.DecodeString(flags)
+	result.Sampled = flagBits[0]&0x01 == 0x01
+	result.TraceState = strings.TrimSpace(traceState)
+
+	return result, result.IsValid()
+}
+
+// isHex returns whether the value only holds lowercase hex digits
+func isHex(value string) bool {
+	for _, char := range value {
+		if (char < '0' || char > '9') && (char < 'a' || char > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// newTraceID returns a random trace id
+func newTraceID() TraceID {
+	var result TraceID
+	for result == (TraceID{}) {
+		rand.Read(result[:])
+	}
+	return result
+}
+
+// newSpanID returns a random span id
+func newSpanID() SpanID {
+	var result SpanID
+	for result == (SpanID{}) {
+		rand.Read(result[:])
+	}
+	return result
+}
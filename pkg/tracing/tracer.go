@@ -0,0 +1,99 @@
+package tracing
+
+import (
+	"context"
+	"time"
+)
+
+// contextKey is the type of the keys used to store tracing values in a context
+type contextKey int
+
+// spanKey stores the current span in a context
+const spanKey contextKey = 0
+
+// remoteKey stores the span context received from another service in a context
+const remoteKey contextKey = 1
+
+// Tracer starts spans and passes them to its exporter once they end
+type Tracer struct {
+	serviceName string
+	exporter    Exporter
+}
+
+// NewTracer is a constructor for a Tracer, spans are still created and propagated without an exporter but not exported
+func NewTracer(serviceName string, exporter Exporter) *Tracer {
+	return &Tracer{
+		serviceName: serviceName,
+		exporter:    exporter,
+	}
+}
+
+// ServiceName returns the name of the service spans are recorded for
+func (t *Tracer) ServiceName() string {
+	return t.serviceName
+}
+
+// Start begins a span of the given kind as a child of the span in ctx, or of the remote span context if there is no
+// current span. A new trace is started if ctx holds neither
+func (t *Tracer) Start(ctx context.Context, name, kind string) (context.Context, *Span) {
+	span := &Span{
+		tracer:    t,
+		Name:      name,
+		Kind:      kind,
+		StartTime: time.Now(),
+		Status:    StatusUnset,
+	}
+
+	if parent := FromContext(ctx); parent != nil {
+		span.Context = parent.Context
+		span.Parent = parent.Context.SpanID
+	} else if remote, ok := ctx.Value(remoteKey).(SpanContext); ok && remote.IsValid() {
+		span.Context = remote
+		span.Parent = remote.SpanID
+	} else {
+		span.Context = SpanContext{TraceID: newTraceID(), Sampled: true}
+	}
+	span.Context.SpanID = newSpanID()
+
+	return context.WithValue(ctx, spanKey, span), span
+}
+
+// Shutdown exports any spans still held by the exporter
+func (t *Tracer) Shutdown() error {
+	if t.exporter == nil {
+		return nil
+	}
+	return t.exporter.Shutdown()
+}
+
+// export passes the ended span to the exporter
+func (t *Tracer) export(span *Span) {
+	if t.exporter != nil {
+		t.exporter.Export(t.serviceName, span)
+	}
+}
+
+// Start begins an internal span as a child of the span in ctx using its tracer. Without a current span the returned
+// span is not recorded, so operations are only traced as part of a traced request
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	parent := FromContext(ctx)
+	if parent == nil || parent.tracer == nil {
+		return ctx, &Span{Name: name, Kind: KindInternal}
+	}
+	return parent.tracer.Start(ctx, name, KindInternal)
+}
+
+// FromContext returns the current span of ctx, nil if there is none
+func FromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(spanKey).(*Span)
+	return span
+}
+
+// WithRemote returns a copy of ctx holding the given span context received from another service, spans started without
+// a current span continue its trace
+func WithRemote(ctx context.Context, remote SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey, remote)
+}